@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
 )
 
 // App struct manages the application lifecycle and API context.
@@ -13,19 +15,102 @@ type App struct {
 	ctx context.Context
 	// BaseURL points to your backend VPS or Cloudflare Tunnel.
 	BaseURL string
+
+	// token is the server-issued session token; api stamps it on every request.
+	token string
+	api   *http.Client
+}
+
+// session is what the server returns from /session, and what we keep on disk
+// so the same pilot comes back next launch.
+type session struct {
+	Token   string `json:"token"`
+	PilotID string `json:"pilot_id"`
 }
 
 // NewApp creates a new App application struct.
 func NewApp() *App {
-	return &App{
+	a := &App{
 		BaseURL: "https://api.playburnrate.com/api",
 	}
+	a.api = &http.Client{Transport: sessionTransport{app: a}}
+	return a
 }
 
 // startup is called when the app starts. The context is saved
 // so we can call runtime methods during the app's life.
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+	if err := a.openSession(); err != nil {
+		println("Session Error:", err.Error())
+	}
+}
+
+// -----------------------------------------------------------------------------
+// SESSION
+// -----------------------------------------------------------------------------
+
+// sessionTransport stamps every API request with the session token.
+type sessionTransport struct {
+	app *App
+}
+
+func (t sessionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Session-Token", t.app.token)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// sessionFile is where the token is kept between launches.
+func sessionFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "galaxies-client", "session.json")
+}
+
+// openSession reuses the saved token if the server still knows it, otherwise
+// asks the server for a new pilot and saves its token.
+func (a *App) openSession() error {
+	if data, err := os.ReadFile(sessionFile()); err == nil {
+		var saved session
+		if json.Unmarshal(data, &saved) == nil && saved.Token != "" {
+			a.token = saved.Token
+			resp, err := a.api.Get(fmt.Sprintf("%s/ship", a.BaseURL))
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode == http.StatusOK {
+					return nil
+				}
+			}
+		}
+	}
+
+	resp, err := http.Post(fmt.Sprintf("%s/session", a.BaseURL), "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("session failed: server returned %d", resp.StatusCode)
+	}
+	var fresh session
+	if err := json.NewDecoder(resp.Body).Decode(&fresh); err != nil {
+		return err
+	}
+	a.token = fresh.Token
+
+	data, _ := json.Marshal(fresh)
+	if err := os.MkdirAll(filepath.Dir(sessionFile()), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(sessionFile(), data, 0600)
+}
+
+// SessionToken lets the frontend authenticate its WebSocket (?token=).
+func (a *App) SessionToken() string {
+	return a.token
 }
 
 // -----------------------------------------------------------------------------
@@ -34,7 +119,7 @@ func (a *App) startup(ctx context.Context) {
 
 // GetShipState fetches the current ship status, including fuel, credits, and location.
 func (a *App) GetShipState() (interface{}, error) {
-	resp, err := http.Get(fmt.Sprintf("%s/ship", a.BaseURL))
+	resp, err := a.api.Get(fmt.Sprintf("%s/ship", a.BaseURL))
 	if err != nil {
 		return nil, err
 	}
@@ -48,7 +133,21 @@ func (a *App) GetShipState() (interface{}, error) {
 
 // GetPlanets fetches the static universe definition (names, coordinates).
 func (a *App) GetPlanets() (interface{}, error) {
-	resp, err := http.Get(fmt.Sprintf("%s/planets", a.BaseURL))
+	resp, err := a.api.Get(fmt.Sprintf("%s/planets", a.BaseURL))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var result interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetPresence fetches the list of online pilots and where they are docked.
+func (a *App) GetPresence() (interface{}, error) {
+	resp, err := a.api.Get(fmt.Sprintf("%s/presence", a.BaseURL))
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +162,7 @@ func (a *App) GetPlanets() (interface{}, error) {
 // Travel sends a POST request to move the ship to a target destination.
 func (a *App) Travel(destKey string) (interface{}, error) {
 	payload, _ := json.Marshal(map[string]string{"destination_key": destKey})
-	resp, err := http.Post(fmt.Sprintf("%s/travel", a.BaseURL), "application/json", bytes.NewBuffer(payload))
+	resp, err := a.api.Post(fmt.Sprintf("%s/travel", a.BaseURL), "application/json", bytes.NewBuffer(payload))
 	if err != nil {
 		return nil, err
 	}
@@ -83,7 +182,7 @@ func (a *App) Travel(destKey string) (interface{}, error) {
 // GetTravelQuote asks the server for the cost of a trip without moving.
 func (a *App) GetTravelQuote(destKey string) (interface{}, error) {
 	payload, _ := json.Marshal(map[string]string{"destination_key": destKey})
-	resp, err := http.Post(fmt.Sprintf("%s/travel/quote", a.BaseURL), "application/json", bytes.NewBuffer(payload))
+	resp, err := a.api.Post(fmt.Sprintf("%s/travel/quote", a.BaseURL), "application/json", bytes.NewBuffer(payload))
 	if err != nil {
 		return nil, err
 	}
@@ -102,7 +201,7 @@ func (a *App) GetTravelQuote(destKey string) (interface{}, error) {
 
 // Refuel attempts to top off the fuel tank at the current station.
 func (a *App) Refuel() (interface{}, error) {
-	resp, err := http.Post(fmt.Sprintf("%s/refuel", a.BaseURL), "application/json", nil)
+	resp, err := a.api.Post(fmt.Sprintf("%s/refuel", a.BaseURL), "application/json", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -125,7 +224,7 @@ func (a *App) Refuel() (interface{}, error) {
 
 // GetAvailableContracts fetches the job board for the current planet.
 func (a *App) GetAvailableContracts() (interface{}, error) {
-	resp, err := http.Get(fmt.Sprintf("%s/contracts", a.BaseURL))
+	resp, err := a.api.Get(fmt.Sprintf("%s/contracts", a.BaseURL))
 	if err != nil {
 		return nil, err
 	}
@@ -140,7 +239,7 @@ func (a *App) GetAvailableContracts() (interface{}, error) {
 // AcceptJob accepts a specific contract ID and adds it to the ship's manifest.
 func (a *App) AcceptJob(jobID string) (interface{}, error) {
 	payload, _ := json.Marshal(map[string]string{"contract_id": jobID})
-	resp, err := http.Post(fmt.Sprintf("%s/contracts/accept", a.BaseURL), "application/json", bytes.NewBuffer(payload))
+	resp, err := a.api.Post(fmt.Sprintf("%s/contracts/accept", a.BaseURL), "application/json", bytes.NewBuffer(payload))
 	if err != nil {
 		return nil, err
 	}
@@ -159,7 +258,7 @@ func (a *App) AcceptJob(jobID string) (interface{}, error) {
 
 func (a *App) DropJob(jobID string) (interface{}, error) {
 	payload, _ := json.Marshal(map[string]string{"contract_id": jobID})
-	resp, err := http.Post(fmt.Sprintf("%s/contracts/drop", a.BaseURL), "application/json", bytes.NewBuffer(payload))
+	resp, err := a.api.Post(fmt.Sprintf("%s/contracts/drop", a.BaseURL), "application/json", bytes.NewBuffer(payload))
 	if err != nil {
 		return nil, fmt.Errorf("network error dropping job: %w", err)
 	}
@@ -183,7 +282,7 @@ func (a *App) DropJob(jobID string) (interface{}, error) {
 // GetModules fetches the list of purchasable upgrades.
 // Note: The backend logic typically returns an empty list if not at 'Prime'.
 func (a *App) GetModules() (interface{}, error) {
-	resp, err := http.Get(fmt.Sprintf("%s/modules", a.BaseURL))
+	resp, err := a.api.Get(fmt.Sprintf("%s/modules", a.BaseURL))
 	if err != nil {
 		return nil, err
 	}
@@ -198,7 +297,7 @@ func (a *App) GetModules() (interface{}, error) {
 // BuyModule attempts to purchase a ship upgrade.
 func (a *App) BuyModule(key string) (interface{}, error) {
 	payload, _ := json.Marshal(map[string]string{"module_key": key})
-	resp, err := http.Post(fmt.Sprintf("%s/modules/buy", a.BaseURL), "application/json", bytes.NewBuffer(payload))
+	resp, err := a.api.Post(fmt.Sprintf("%s/modules/buy", a.BaseURL), "application/json", bytes.NewBuffer(payload))
 	if err != nil {
 		return nil, err
 	}
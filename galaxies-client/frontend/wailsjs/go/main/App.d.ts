@@ -13,10 +13,14 @@ export function GetModules():Promise<any>;
 
 export function GetPlanets():Promise<any>;
 
+export function GetPresence():Promise<any>;
+
 export function GetShipState():Promise<any>;
 
 export function GetTravelQuote(arg1:string):Promise<any>;
 
 export function Refuel():Promise<any>;
 
+export function SessionToken():Promise<string>;
+
 export function Travel(arg1:string):Promise<any>;
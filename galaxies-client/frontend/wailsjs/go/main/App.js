@@ -26,6 +26,10 @@ export function GetPlanets() {
   return window['go']['main']['App']['GetPlanets']();
 }
 
+export function GetPresence() {
+  return window['go']['main']['App']['GetPresence']();
+}
+
 export function GetShipState() {
   return window['go']['main']['App']['GetShipState']();
 }
@@ -38,6 +42,10 @@ export function Refuel() {
   return window['go']['main']['App']['Refuel']();
 }
 
+export function SessionToken() {
+  return window['go']['main']['App']['SessionToken']();
+}
+
 export function Travel(arg1) {
   return window['go']['main']['App']['Travel'](arg1);
 }
@@ -0,0 +1,221 @@
+/*
+Package main
+File: auctions.go
+Description: Premium contract auctions. Each heartbeat the primary may post a
+high-value cargo job to auction instead of the public board. Pilots docked at the
+origin bid the payout down, and faction standing makes a bid count for more; when
+the auction closes the best bidder who is still docked with room aboard wins the job. Updates go out as "auction_update" messages.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// AuctionConfig tunes premium auctions from YAML.
+type AuctionConfig struct {
+	PostsPerTick    int     `yaml:"posts_per_tick" json:"posts_per_tick"`     // New auctions per heartbeat
+	MaxOpen         int     `yaml:"max_open" json:"max_open"`                 // Cap on concurrent auctions
+	PayoutMult      float64 `yaml:"payout_mult" json:"payout_mult"`           // Asking payout vs. a normal job
+	DurationSeconds int     `yaml:"duration_seconds" json:"duration_seconds"` // Time until close
+	MinBidFraction  float64 `yaml:"min_bid_fraction" json:"min_bid_fraction"` // Lowest bid allowed, as a fraction of asking
+	MinUndercut     int     `yaml:"min_undercut" json:"min_undercut"`         // Score a new bid must beat the leader by
+}
+
+// Bid is one pilot's offer to fly the job for Amount credits. Score is the
+// amount less the value of the bidder's standing with the issuing faction;
+// lowest wins.
+type Bid struct {
+	PilotID  string `json:"pilot_id"`
+	Amount   int    `json:"amount"`
+	Score    int    `json:"score"`
+	PlacedAt int64  `json:"placed_at"` // Unix seconds
+}
+
+// bidScore weighs a bid by the bidder's standing with the job's faction.
+func bidScore(pilotID string, c Contract, amount int) int {
+	return amount - standing(pilotID, c.Faction)*CurrentUniverse.ReputationConfig.AuctionCreditsPerPt
+}
+
+// Auction is a premium contract awaiting bids.
+type Auction struct {
+	ID           string   `json:"id"`
+	Contract     Contract `json:"contract"`
+	AskingPayout int      `json:"asking_payout"`
+	ClosesAt     int64    `json:"closes_at"` // Unix seconds
+	Bids         []Bid    `json:"bids"`
+	Status       string   `json:"status"` // "open", "awarded", "unsold"
+	WinnerID     string   `json:"winner_id,omitempty"`
+}
+
+// leadingBid returns the best-scoring bid, if any.
+func (a *Auction) leadingBid() (Bid, bool) {
+	if len(a.Bids) == 0 {
+		return Bid{}, false
+	}
+	best := a.Bids[0]
+	for _, b := range a.Bids[1:] {
+		if b.Score < best.Score {
+			best = b
+		}
+	}
+	return best, true
+}
+
+// Auctions holds open auctions. Guarded by dataLock.
+var Auctions = []*Auction{}
+
+// PostAuctions puts new premium jobs up for auction.
+func PostAuctions() {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+
+	cfg := CurrentUniverse.AuctionConfig
+	if len(CurrentUniverse.Planets) == 0 {
+		return
+	}
+	for i := 0; i < cfg.PostsPerTick && len(Auctions) < cfg.MaxOpen; i++ {
+		origin := &CurrentUniverse.Planets[rand.Intn(len(CurrentUniverse.Planets))]
+		job := newCargoContract(origin)
+		if job == nil {
+			continue
+		}
+		job.ID = fmt.Sprintf("AUC-%d-%d", rand.Intn(99999), time.Now().UnixNano()%1000)
+		job.Payout = int(float64(job.Payout) * cfg.PayoutMult)
+
+		a := &Auction{
+			ID:           job.ID,
+			Contract:     *job,
+			AskingPayout: job.Payout,
+			ClosesAt:     time.Now().Add(time.Duration(cfg.DurationSeconds) * time.Second).Unix(),
+			Bids:         []Bid{},
+			Status:       "open",
+		}
+		Auctions = append(Auctions, a)
+		broadcastAuction("posted", a)
+		log.Printf("Auction posted: %s %dx %s %s -> %s for %d CR",
+			a.ID, job.Quantity, job.ItemName, job.OriginKey, job.DestinationKey, a.AskingPayout)
+	}
+}
+
+// PlaceBid offers to fly an auctioned job for amount credits. The pilot must be
+// docked at the origin with room for the job. Caller holds dataLock.
+func PlaceBid(ship *Ship, auctionID string, amount int) (*Auction, error) {
+	var a *Auction
+	for _, open := range Auctions {
+		if open.ID == auctionID {
+			a = open
+			break
+		}
+	}
+	if a == nil || time.Now().Unix() >= a.ClosesAt {
+		return nil, serviceError(http.StatusNotFound, "Auction not found or closed")
+	}
+	if ship.LocationKey != a.Contract.OriginKey {
+		return nil, serviceError(http.StatusForbidden, "Must be docked at the origin to bid")
+	}
+	if err := canCarry(ship, a.Contract); err != nil {
+		return nil, err
+	}
+
+	cfg := CurrentUniverse.AuctionConfig
+	if amount > a.AskingPayout {
+		return nil, serviceError(http.StatusBadRequest, "Bid exceeds asking payout")
+	}
+	if float64(amount) < float64(a.AskingPayout)*cfg.MinBidFraction {
+		return nil, serviceError(http.StatusBadRequest, "Bid below auction floor")
+	}
+	if err := checkStanding(ship.PilotID, a.Contract); err != nil {
+		return nil, err
+	}
+	score := bidScore(ship.PilotID, a.Contract, amount)
+	if best, ok := a.leadingBid(); ok && score > best.Score-cfg.MinUndercut {
+		return nil, serviceError(http.StatusConflict, fmt.Sprintf("Bid must beat the leading score %d by at least %d", best.Score, cfg.MinUndercut))
+	}
+
+	a.Bids = append(a.Bids, Bid{PilotID: ship.PilotID, Amount: amount, Score: score, PlacedAt: time.Now().Unix()})
+	broadcastAuction("bid", a)
+	return a, nil
+}
+
+// CloseAuctions awards every auction past its closing time. Bids are tried from
+// best score to worst (earliest wins ties); a bidder who has left the origin or
+// filled their hold is skipped. Unsold jobs go to the public board at asking
+// price.
+func CloseAuctions() {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+
+	now := time.Now().Unix()
+	open := []*Auction{}
+	for _, a := range Auctions {
+		if now < a.ClosesAt {
+			open = append(open, a)
+			continue
+		}
+		awardAuction(a)
+		broadcastAuction(a.Status, a)
+	}
+	Auctions = open
+}
+
+// awardAuction settles one closed auction. Caller holds dataLock.
+func awardAuction(a *Auction) {
+	bids := append([]Bid{}, a.Bids...)
+	sort.SliceStable(bids, func(i, j int) bool {
+		if bids[i].Score != bids[j].Score {
+			return bids[i].Score < bids[j].Score
+		}
+		return bids[i].PlacedAt < bids[j].PlacedAt
+	})
+
+	for _, b := range bids {
+		ship, ok := Pilots[b.PilotID]
+		if !ok || ship.LocationKey != a.Contract.OriginKey || canCarry(ship, a.Contract) != nil {
+			continue
+		}
+		job := a.Contract
+		job.Payout = b.Amount
+		ship.ActiveContracts = append(ship.ActiveContracts, job)
+		Market.RecordAcceptance(job.OriginKey, job.ItemKey, job.Quantity)
+
+		a.Status = "awarded"
+		a.WinnerID = b.PilotID
+		gameHub.SendToPilot(ship.PilotID, "auction_won", a)
+		notifyShip(ship)
+		log.Printf("Auction %s awarded to %s for %d CR", a.ID, b.PilotID, b.Amount)
+		return
+	}
+
+	a.Status = "unsold"
+	AvailableContracts[a.Contract.OriginKey] = append(AvailableContracts[a.Contract.OriginKey], a.Contract)
+}
+
+// runAuctionClock closes auctions on time rather than waiting for the
+// heartbeat.
+func runAuctionClock() {
+	ticker := time.NewTicker(5 * time.Second)
+	for range ticker.C {
+		CloseAuctions()
+	}
+}
+
+// broadcastAuction tells every client about a new auction, bid or result.
+func broadcastAuction(status string, a *Auction) {
+	data, err := json.Marshal(Message{
+		Type:    "auction_update",
+		Payload: map[string]interface{}{"status": status, "auction": a},
+		Sender:  "SERVER",
+	})
+	if err != nil {
+		return
+	}
+	gameHub.Broadcast(data)
+}
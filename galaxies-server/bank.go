@@ -0,0 +1,335 @@
+/*
+Package main
+File: bank.go
+Description: The bank. Pilots borrow against their net worth and interest accrues
+on the balance every heartbeat. A loan that outgrows the pilot's credit limit goes
+into default: the bank garnishes part of every payout and repossesses installed
+modules, one per heartbeat, until the balance is back under the limit. The bank
+also runs the emergency tow for pilots stranded without fuel or credits; the fee
+comes out of credits, or onto the loan if they can't cover it.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+)
+
+// BankConfig tunes lending and towing from YAML.
+type BankConfig struct {
+	InterestPerTick    float64 `yaml:"interest_per_tick" json:"interest_per_tick"`     // Interest added to the balance each heartbeat
+	BaseCreditLimit    int     `yaml:"base_credit_limit" json:"base_credit_limit"`     // Lent to anyone, net worth or not
+	NetWorthRatio      float64 `yaml:"net_worth_ratio" json:"net_worth_ratio"`         // Extra limit per credit of net worth
+	GarnishRate        float64 `yaml:"garnish_rate" json:"garnish_rate"`               // Share of each payout seized while in default
+	RepossessionResale float64 `yaml:"repossession_resale" json:"repossession_resale"` // Module value (share of cost) counted in net worth and repossession
+	TowBaseFee         int     `yaml:"tow_base_fee" json:"tow_base_fee"`               // Flat fee for a tow
+	TowFeePerLY        int     `yaml:"tow_fee_per_ly" json:"tow_fee_per_ly"`           // Plus this per LY towed
+	TowFuel            int64   `yaml:"tow_fuel" json:"tow_fuel"`                       // Fuel the tow leaves in the tank (at least)
+	TowDefaultDest     string  `yaml:"tow_default_destination" json:"tow_default_destination"`
+}
+
+// Loan is a pilot's outstanding debt.
+type Loan struct {
+	PilotID   string `json:"pilot_id"`
+	Balance   int    `json:"balance"`
+	Defaulted bool   `json:"defaulted"`
+}
+
+// BankStatus is the response of /api/bank.
+type BankStatus struct {
+	Balance     int        `json:"balance"`
+	Defaulted   bool       `json:"defaulted"`
+	NetWorth    int        `json:"net_worth"`
+	CreditLimit int        `json:"credit_limit"`
+	Available   int        `json:"available"` // Still borrowable
+	Config      BankConfig `json:"config"`
+}
+
+// BankNotice is pushed to a pilot when the bank acts on their loan.
+type BankNotice struct {
+	Event  string `json:"event"` // "defaulted", "repossessed", "garnished", "cleared", "repaid"
+	Text   string `json:"text"`
+	Amount int    `json:"amount,omitempty"`
+	Loan   Loan   `json:"loan"`
+}
+
+// TowResult is a tow's arrival plus its fee.
+type TowResult struct {
+	TravelResult
+	Fee     int `json:"fee"`
+	FeeDebt int `json:"fee_debt"` // Part of the fee added to the loan
+}
+
+// Loans maps PilotID -> outstanding loan. Guarded by dataLock.
+var Loans = make(map[string]*Loan)
+
+// debt is a pilot's outstanding balance (0 if none).
+func debt(pilotID string) int {
+	if loan, ok := Loans[pilotID]; ok {
+		return loan.Balance
+	}
+	return 0
+}
+
+// moduleValue is what the bank counts an installed module as worth.
+func moduleValue(mod ShipModule) int {
+	return int(float64(mod.Cost) * CurrentUniverse.BankConfig.RepossessionResale)
+}
+
+// netWorth is credits plus the value of the pilot's own modules, less debt.
+// Corp-funded modules belong to the corp and don't count.
+func netWorth(ship *Ship) int {
+	worth := ship.Credits - debt(ship.PilotID)
+	for _, m := range ship.InstalledModules {
+		if m.CorpID == "" {
+			worth += moduleValue(m)
+		}
+	}
+	return worth
+}
+
+// creditLimit is the most a pilot may owe.
+func creditLimit(ship *Ship) int {
+	cfg := CurrentUniverse.BankConfig
+	worth := netWorth(ship)
+	if worth < 0 {
+		worth = 0
+	}
+	return cfg.BaseCreditLimit + int(float64(worth)*cfg.NetWorthRatio)
+}
+
+// addDebt grows (or opens) a pilot's loan. Caller holds dataLock.
+func addDebt(pilotID string, amount int) *Loan {
+	loan, ok := Loans[pilotID]
+	if !ok {
+		loan = &Loan{PilotID: pilotID}
+		Loans[pilotID] = loan
+	}
+	loan.Balance += amount
+	return loan
+}
+
+// payDebt takes up to amount off a loan, closing it once paid. Returns what was
+// actually applied. Caller holds dataLock.
+func payDebt(pilotID string, amount int) int {
+	loan, ok := Loans[pilotID]
+	if !ok || amount <= 0 {
+		return 0
+	}
+	if amount > loan.Balance {
+		amount = loan.Balance
+	}
+	loan.Balance -= amount
+	if loan.Balance <= 0 {
+		delete(Loans, pilotID)
+	}
+	return amount
+}
+
+// GetBankStatus reports a pilot's loan and credit. Caller holds dataLock.
+func GetBankStatus(ship *Ship) BankStatus {
+	status := BankStatus{
+		NetWorth:    netWorth(ship),
+		CreditLimit: creditLimit(ship),
+		Config:      CurrentUniverse.BankConfig,
+	}
+	if loan, ok := Loans[ship.PilotID]; ok {
+		status.Balance = loan.Balance
+		status.Defaulted = loan.Defaulted
+	}
+	status.Available = status.CreditLimit - status.Balance
+	if status.Available < 0 || status.Defaulted {
+		status.Available = 0
+	}
+	return status
+}
+
+// Borrow lends credits up to the pilot's credit limit. Caller holds dataLock.
+func Borrow(ship *Ship, amount int) (BankStatus, error) {
+	if amount <= 0 {
+		return BankStatus{}, serviceError(http.StatusBadRequest, "Amount must be positive")
+	}
+	status := GetBankStatus(ship)
+	if status.Defaulted {
+		return BankStatus{}, serviceError(http.StatusForbidden, "Loan is in default")
+	}
+	if amount > status.Available {
+		return BankStatus{}, serviceError(http.StatusPaymentRequired, fmt.Sprintf("Credit limit exceeded (%d available)", status.Available))
+	}
+
+	addDebt(ship.PilotID, amount)
+	moveCredits(ship, amount, LedgerEntry{Reason: "loan_borrowed"})
+	return GetBankStatus(ship), nil
+}
+
+// Repay pays down the loan from credits. An amount of 0 repays as much as the
+// pilot can. Caller holds dataLock.
+func Repay(ship *Ship, amount int) (BankStatus, error) {
+	if debt(ship.PilotID) == 0 {
+		return BankStatus{}, serviceError(http.StatusBadRequest, "No outstanding loan")
+	}
+	if amount < 0 {
+		return BankStatus{}, serviceError(http.StatusBadRequest, "Amount must be positive")
+	}
+	if amount == 0 || amount > ship.Credits {
+		amount = ship.Credits
+	}
+	if amount <= 0 {
+		return BankStatus{}, serviceError(http.StatusPaymentRequired, "Insufficient credits")
+	}
+
+	moveCredits(ship, -payDebt(ship.PilotID, amount), LedgerEntry{Reason: "loan_repaid"})
+	if loan, ok := Loans[ship.PilotID]; ok && loan.Defaulted && loan.Balance <= creditLimit(ship) {
+		loan.Defaulted = false
+	}
+	return GetBankStatus(ship), nil
+}
+
+// garnish takes the bank's share of a payout from a pilot in default.
+// Returns the credits taken. Caller holds dataLock.
+func garnish(pilotID string, payout int) int {
+	loan, ok := Loans[pilotID]
+	if !ok || !loan.Defaulted || payout <= 0 {
+		return 0
+	}
+	taken := payDebt(pilotID, int(float64(payout)*CurrentUniverse.BankConfig.GarnishRate))
+	if taken > 0 {
+		sendBankNotice(loan, "garnished", taken, fmt.Sprintf("The bank garnished %d credits of your payout.", taken))
+	}
+	return taken
+}
+
+// BankTick accrues interest on every loan, puts loans over their limit into
+// default and repossesses a module from each defaulted pilot.
+func BankTick() {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+
+	cfg := CurrentUniverse.BankConfig
+	for pilotID, loan := range Loans {
+		ship, ok := Pilots[pilotID]
+		if !ok {
+			continue
+		}
+
+		// 1. Interest, rounded up so small loans still cost something
+		loan.Balance += int(math.Ceil(float64(loan.Balance) * cfg.InterestPerTick))
+		limit := creditLimit(ship)
+
+		// 2. Over the limit: default
+		if !loan.Defaulted && loan.Balance > limit {
+			loan.Defaulted = true
+			sendBankNotice(loan, "defaulted", 0, fmt.Sprintf("Your loan of %d credits exceeds your credit limit of %d. Payouts will be garnished and modules repossessed.", loan.Balance, limit))
+			continue
+		}
+		if !loan.Defaulted {
+			continue
+		}
+
+		// 3. Repossess the most recently installed module the pilot paid for
+		n := len(ship.InstalledModules) - 1
+		for n >= 0 && ship.InstalledModules[n].CorpID != "" {
+			n--
+		}
+		if n >= 0 {
+			mod := ship.InstalledModules[n]
+			ship.InstalledModules = append(ship.InstalledModules[:n], ship.InstalledModules[n+1:]...)
+			applyModuleStats(ship, mod, -1)
+			value := moduleValue(mod)
+			surplus := value - payDebt(pilotID, value)
+			moveCredits(ship, surplus, LedgerEntry{Reason: "repossession_surplus", ModuleKey: mod.Key})
+			sendBankNotice(loan, "repossessed", value, fmt.Sprintf("The bank repossessed your %s for %d credits.", mod.Name, value))
+			notifyShip(ship)
+		}
+
+		// 4. Back within the limit: default lifted
+		if _, open := Loans[pilotID]; !open {
+			sendBankNotice(loan, "repaid", 0, "Your loan has been paid off.")
+		} else if loan.Balance <= creditLimit(ship) {
+			loan.Defaulted = false
+			sendBankNotice(loan, "cleared", 0, "Your loan is back within its credit limit. The default has been lifted.")
+		}
+	}
+}
+
+// shipStranded reports whether a ship can reach no other planet, either on the
+// fuel in its tank or after buying a full tank here.
+func shipStranded(ship *Ship) bool {
+	if len(CurrentUniverse.Planets) < 2 || canJump(ship, ship.Fuel) {
+		return false
+	}
+	return ship.Credits < refuelCost(ship) || !canJump(ship, ship.MaxFuel)
+}
+
+// canJump reports whether fuel covers a jump to any other planet at the ship's
+// current mass.
+func canJump(ship *Ship, fuel int64) bool {
+	for _, p := range CurrentUniverse.Planets {
+		if p.Key == ship.LocationKey {
+			continue
+		}
+		if quote, err := QuoteTravel(ship, p.Key); err == nil && quote.FuelCost <= fuel {
+			return true
+		}
+	}
+	return false
+}
+
+// sendBankNotice pushes a "bank_notice" to the borrower. Caller holds dataLock.
+func sendBankNotice(loan *Loan, event string, amount int, text string) {
+	gameHub.SendToPilot(loan.PilotID, "bank_notice", BankNotice{
+		Event:  event,
+		Text:   text,
+		Amount: amount,
+		Loan:   *loan,
+	})
+}
+
+// TowShip hauls a stranded ship to a planet without burning its fuel and leaves
+// it with at least TowFuel in the tank. The fee is paid from credits, with any
+// shortfall added to the loan. Cargo aboard arrives as if flown. Caller holds
+// dataLock.
+func TowShip(ship *Ship, destKey string) (TowResult, error) {
+	cfg := CurrentUniverse.BankConfig
+	if !shipStranded(ship) {
+		return TowResult{}, serviceError(http.StatusConflict, "Ship is not stranded")
+	}
+	if destKey == "" {
+		destKey = cfg.TowDefaultDest
+	}
+	origin := GetPlanet(ship.LocationKey)
+	dest := GetPlanet(destKey)
+	if dest == nil {
+		return TowResult{}, serviceError(http.StatusNotFound, "Destination not found")
+	}
+	if dest.Key == ship.LocationKey {
+		return TowResult{}, serviceError(http.StatusBadRequest, "Already docked there")
+	}
+
+	var dist int64
+	if origin != nil {
+		dist = CalculateDistance(origin.Coordinates, dest.Coordinates)
+	}
+	fee := cfg.TowBaseFee + cfg.TowFeePerLY*int(dist)
+
+	result := TowResult{TravelResult: arrive(ship, dest.Key, TravelQuote{Distance: dist}), Fee: fee}
+	if ship.Fuel < cfg.TowFuel {
+		ship.Fuel = cfg.TowFuel
+		if ship.Fuel > ship.MaxFuel {
+			ship.Fuel = ship.MaxFuel
+		}
+	}
+
+	// Payouts on arrival count towards the fee
+	paid := fee
+	if paid > ship.Credits {
+		paid = ship.Credits
+	}
+	moveCredits(ship, -paid, LedgerEntry{Reason: "tow_fee", Note: dest.Key})
+	if result.FeeDebt = fee - paid; result.FeeDebt > 0 {
+		addDebt(ship.PilotID, result.FeeDebt)
+	}
+	return result, nil
+}
@@ -0,0 +1,230 @@
+/*
+Package main
+File: broker.go
+Description: Pub/sub backends for the Hub. The in-memory broker serves a single
+process; the Redis broker speaks the RESP protocol (PUBLISH/SUBSCRIBE) so several
+server instances can share chat, market and ship events through Redis or any
+compatible stand-in (KeyDB, Dragonfly, a local test server...).
+*/
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Broker moves hub envelopes between server instances.
+type Broker interface {
+	Publish(topic string, data []byte) error
+	Subscribe(topic string) (<-chan []byte, error)
+}
+
+// hubTopic carries every hub envelope.
+const hubTopic = "galaxies:hub"
+
+// --- IN-MEMORY ---
+
+// MemoryBroker fans out to subscribers in the same process.
+type MemoryBroker struct {
+	mu   sync.RWMutex
+	subs map[string][]chan []byte
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{subs: make(map[string][]chan []byte)}
+}
+
+func (b *MemoryBroker) Publish(topic string, data []byte) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, ch := range b.subs[topic] {
+		ch <- data
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(topic string) (<-chan []byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan []byte, 256)
+	b.subs[topic] = append(b.subs[topic], ch)
+	return ch, nil
+}
+
+// --- REDIS (RESP) ---
+
+// RedisBroker publishes over one shared connection and subscribes on dedicated
+// connections, reconnecting with a short backoff if Redis goes away.
+type RedisBroker struct {
+	addr string
+
+	mu   sync.Mutex // Guards the publish connection
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// NewRedisBroker connects to a RESP server at addr (host:port).
+func NewRedisBroker(addr string) (*RedisBroker, error) {
+	b := &RedisBroker{addr: addr}
+	if err := b.connect(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *RedisBroker) connect() error {
+	conn, err := net.DialTimeout("tcp", b.addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	b.conn = conn
+	b.rd = bufio.NewReader(conn)
+	return nil
+}
+
+func (b *RedisBroker) Publish(topic string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn == nil {
+		if err := b.connect(); err != nil {
+			return err
+		}
+	}
+	err := b.publishOnce(topic, data)
+	if err != nil {
+		// Retry once on a fresh connection (covers a Redis restart)
+		b.conn.Close()
+		b.conn = nil
+		if err = b.connect(); err != nil {
+			return err
+		}
+		err = b.publishOnce(topic, data)
+	}
+	return err
+}
+
+func (b *RedisBroker) publishOnce(topic string, data []byte) error {
+	if err := writeRESP(b.conn, "PUBLISH", topic, string(data)); err != nil {
+		return err
+	}
+	_, err := readRESP(b.rd)
+	return err
+}
+
+func (b *RedisBroker) Subscribe(topic string) (<-chan []byte, error) {
+	out := make(chan []byte, 256)
+	conn, err := b.subscribeConn(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			rd := bufio.NewReader(conn)
+			for {
+				reply, err := readRESP(rd)
+				if err != nil {
+					log.Printf("Broker: subscription lost: %v", err)
+					break
+				}
+				// Pushes look like ["message", topic, payload]
+				parts, ok := reply.([]interface{})
+				if !ok || len(parts) != 3 {
+					continue
+				}
+				if kind, _ := parts[0].(string); kind != "message" {
+					continue
+				}
+				if payload, ok := parts[2].(string); ok {
+					out <- []byte(payload)
+				}
+			}
+			conn.Close()
+
+			for {
+				time.Sleep(2 * time.Second)
+				if conn, err = b.subscribeConn(topic); err == nil {
+					log.Printf("Broker: resubscribed to %s", topic)
+					break
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (b *RedisBroker) subscribeConn(topic string) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", b.addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeRESP(conn, "SUBSCRIBE", topic); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// writeRESP sends a command as a RESP array of bulk strings.
+func writeRESP(w io.Writer, args ...string) error {
+	buf := fmt.Sprintf("*%d\r\n", len(args))
+	for _, a := range args {
+		buf += fmt.Sprintf("$%d\r\n%s\r\n", len(a), a)
+	}
+	_, err := io.WriteString(w, buf)
+	return err
+}
+
+// readRESP reads one reply: strings and bulk strings become string, integers
+// int64, arrays []interface{}, nil bulk strings nil, and error replies an error.
+func readRESP(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, errors.New("resp: short line")
+	}
+	body := line[1 : len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, errors.New(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readRESP(rd); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("resp: unknown type %q", line[0])
+}
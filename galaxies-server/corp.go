@@ -0,0 +1,482 @@
+/*
+Package main
+File: corp.go
+Description: Player corporations. A pilot founds a corporation (open to anyone, or
+invite-only) and members pool credits in its treasury. Each member holds a role
+from universe.yaml whose permissions decide who may withdraw, post and accept corp
+contracts, buy modules with corp funds and manage members. Corp contracts sit on a
+private board, funded from the treasury in escrow like player postings. Every
+treasury movement is written to the corp ledger, and members share a chat channel.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Corp permissions
+const (
+	PermWithdraw        = "withdraw"
+	PermPostContracts   = "post_contracts"
+	PermAcceptContracts = "accept_contracts"
+	PermBuyModules      = "buy_modules"
+	PermManageMembers   = "manage_members"
+)
+
+// CorpRole is a role from YAML.
+type CorpRole struct {
+	Key         string   `yaml:"key" json:"key"`
+	Name        string   `yaml:"name" json:"name"`
+	Permissions []string `yaml:"permissions" json:"permissions"`
+}
+
+// CorpConfig tunes corporations from YAML.
+type CorpConfig struct {
+	FoundingFee int        `yaml:"founding_fee" json:"founding_fee"`
+	MaxMembers  int        `yaml:"max_members" json:"max_members"`
+	LedgerSize  int        `yaml:"ledger_size" json:"ledger_size"` // Entries kept per corp
+	ChatSize    int        `yaml:"chat_size" json:"chat_size"`     // Messages kept per corp
+	FounderRole string     `yaml:"founder_role" json:"founder_role"`
+	DefaultRole string     `yaml:"default_role" json:"default_role"`
+	Roles       []CorpRole `yaml:"roles" json:"roles"`
+}
+
+// CorpLedgerEntry is one treasury movement.
+type CorpLedgerEntry struct {
+	Time    int64  `json:"time"` // Unix seconds
+	PilotID string `json:"pilot_id,omitempty"`
+	Kind    string `json:"kind"`   // "deposit", "withdraw", "contract_posted", "contract_refund", "contract_settled", "module_purchase"
+	Amount  int    `json:"amount"` // Positive into the treasury, negative out
+	Balance int    `json:"balance"`
+	Note    string `json:"note,omitempty"`
+}
+
+// CorpChatMessage is one line in a corp's channel.
+type CorpChatMessage struct {
+	Time    int64  `json:"time"`
+	PilotID string `json:"pilot_id"`
+	Sender  string `json:"sender"`
+	Text    string `json:"text"`
+}
+
+// Corp is a player corporation.
+type Corp struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Tag      string            `json:"tag"`
+	Open     bool              `json:"open"` // Anyone may join; otherwise invite only
+	Treasury int               `json:"treasury"`
+	Members  map[string]string `json:"members"` // PilotID -> role key
+	Invites  map[string]bool   `json:"-"`
+	Board    []Contract        `json:"-"` // Corp contracts not yet accepted
+	Ledger   []CorpLedgerEntry `json:"-"`
+	Chat     []CorpChatMessage `json:"-"`
+}
+
+// CorpSummary is a corp as outsiders see it.
+type CorpSummary struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Tag     string `json:"tag"`
+	Open    bool   `json:"open"`
+	Members int    `json:"members"`
+}
+
+// CreateCorpRequest founds a corporation.
+type CreateCorpRequest struct {
+	Name string `json:"name"`
+	Tag  string `json:"tag"`
+	Open bool   `json:"open"`
+}
+
+// Corps maps CorpID -> corporation and CorpOf maps PilotID -> CorpID.
+// Both guarded by dataLock.
+var (
+	Corps  = make(map[string]*Corp)
+	CorpOf = make(map[string]string)
+)
+
+// getCorpRole finds a role by key.
+func getCorpRole(key string) *CorpRole {
+	for i := range CurrentUniverse.CorpConfig.Roles {
+		if CurrentUniverse.CorpConfig.Roles[i].Key == key {
+			return &CurrentUniverse.CorpConfig.Roles[i]
+		}
+	}
+	return nil
+}
+
+// myCorp is the pilot's corporation.
+func myCorp(pilotID string) (*Corp, error) {
+	corp, ok := Corps[CorpOf[pilotID]]
+	if !ok {
+		return nil, serviceError(http.StatusNotFound, "Not in a corporation")
+	}
+	return corp, nil
+}
+
+// can reports whether a member's role grants a permission.
+func (c *Corp) can(pilotID, perm string) bool {
+	role := getCorpRole(c.Members[pilotID])
+	if role == nil {
+		return false
+	}
+	for _, p := range role.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// requirePerm returns the pilot's corp if their role grants perm.
+func requirePerm(pilotID, perm string) (*Corp, error) {
+	corp, err := myCorp(pilotID)
+	if err != nil {
+		return nil, err
+	}
+	if !corp.can(pilotID, perm) {
+		return nil, serviceError(http.StatusForbidden, "Your corp role lacks the "+perm+" permission")
+	}
+	return corp, nil
+}
+
+// record moves the treasury and writes the ledger entry. Caller holds dataLock.
+func (c *Corp) record(pilotID, kind string, amount int, note string) {
+	c.Treasury += amount
+	c.Ledger = append(c.Ledger, CorpLedgerEntry{
+		Time:    time.Now().Unix(),
+		PilotID: pilotID,
+		Kind:    kind,
+		Amount:  amount,
+		Balance: c.Treasury,
+		Note:    note,
+	})
+	if max := CurrentUniverse.CorpConfig.LedgerSize; max > 0 && len(c.Ledger) > max {
+		c.Ledger = c.Ledger[len(c.Ledger)-max:]
+	}
+}
+
+// SpendTreasury pays for something from corp funds if the pilot's role allows
+// it. Caller holds dataLock.
+func SpendTreasury(pilotID, perm string, amount int, kind, note string) error {
+	corp, err := requirePerm(pilotID, perm)
+	if err != nil {
+		return err
+	}
+	if corp.Treasury < amount {
+		return serviceError(http.StatusPaymentRequired, "Insufficient corp funds")
+	}
+	corp.record(pilotID, kind, -amount, note)
+	return nil
+}
+
+// CreateCorp founds a corporation with the pilot as its first member.
+// Caller holds dataLock.
+func CreateCorp(ship *Ship, req CreateCorpRequest) (*Corp, error) {
+	cfg := CurrentUniverse.CorpConfig
+	name, tag := strings.TrimSpace(req.Name), strings.ToUpper(strings.TrimSpace(req.Tag))
+	if name == "" || tag == "" || len(tag) > 5 {
+		return nil, serviceError(http.StatusBadRequest, "Name and a tag of up to 5 characters are required")
+	}
+	if _, in := CorpOf[ship.PilotID]; in {
+		return nil, serviceError(http.StatusConflict, "Already in a corporation")
+	}
+	for _, c := range Corps {
+		if strings.EqualFold(c.Name, name) || c.Tag == tag {
+			return nil, serviceError(http.StatusConflict, "Name or tag already taken")
+		}
+	}
+	if ship.Credits < cfg.FoundingFee {
+		return nil, serviceError(http.StatusPaymentRequired, "Insufficient credits for the founding fee")
+	}
+
+	corp := &Corp{
+		ID:      fmt.Sprintf("CORP-%d-%d", rand.Intn(99999), time.Now().UnixNano()%1000),
+		Name:    name,
+		Tag:     tag,
+		Open:    req.Open,
+		Members: map[string]string{ship.PilotID: cfg.FounderRole},
+		Invites: map[string]bool{},
+		Board:   []Contract{},
+	}
+	Corps[corp.ID] = corp
+	CorpOf[ship.PilotID] = corp.ID
+	moveCredits(ship, -cfg.FoundingFee, LedgerEntry{Reason: "corp_founding_fee", Counterparty: corp.ID})
+	return corp, nil
+}
+
+// JoinCorp joins an open corp, or one the pilot was invited to. Caller holds dataLock.
+func JoinCorp(ship *Ship, corpID string) (*Corp, error) {
+	corp, ok := Corps[corpID]
+	if !ok {
+		return nil, serviceError(http.StatusNotFound, "Corporation not found")
+	}
+	if _, in := CorpOf[ship.PilotID]; in {
+		return nil, serviceError(http.StatusConflict, "Already in a corporation")
+	}
+	if !corp.Open && !corp.Invites[ship.PilotID] {
+		return nil, serviceError(http.StatusForbidden, "Corporation is invite only")
+	}
+	if max := CurrentUniverse.CorpConfig.MaxMembers; max > 0 && len(corp.Members) >= max {
+		return nil, serviceError(http.StatusConflict, "Corporation is full")
+	}
+	delete(corp.Invites, ship.PilotID)
+	corp.Members[ship.PilotID] = CurrentUniverse.CorpConfig.DefaultRole
+	CorpOf[ship.PilotID] = corp.ID
+	return corp, nil
+}
+
+// LeaveCorp leaves the pilot's corp. The last member out dissolves it and takes
+// the treasury and any unaccepted contracts' escrow, but not while corp
+// contracts are still being flown. Caller holds dataLock.
+func LeaveCorp(ship *Ship) error {
+	corp, err := myCorp(ship.PilotID)
+	if err != nil {
+		return err
+	}
+	if len(corp.Members) > 1 && corp.Members[ship.PilotID] == CurrentUniverse.CorpConfig.FounderRole {
+		founders := 0
+		for _, role := range corp.Members {
+			if role == CurrentUniverse.CorpConfig.FounderRole {
+				founders++
+			}
+		}
+		if founders == 1 {
+			return serviceError(http.StatusConflict, "Hand over your role before leaving")
+		}
+	}
+
+	if len(corp.Members) == 1 && corpHauling(corp.ID) {
+		return serviceError(http.StatusConflict, "Corp contracts are still in transit")
+	}
+
+	delete(corp.Members, ship.PilotID)
+	delete(CorpOf, ship.PilotID)
+	if len(corp.Members) == 0 {
+		for _, c := range corp.Board {
+			corp.record("", "contract_refund", c.Escrow, c.ID)
+		}
+		moveCredits(ship, corp.Treasury, LedgerEntry{Reason: "corp_dissolved", Counterparty: corp.ID})
+		delete(Corps, corp.ID)
+	}
+	return nil
+}
+
+// corpHauling reports whether any player or NPC is flying one of the corp's
+// contracts. Their escrow is still owed to the corp on delivery or refund, so
+// the corp can't dissolve yet. Caller holds dataLock.
+func corpHauling(corpID string) bool {
+	for _, ship := range append(allPlayerShips(), NPCs...) {
+		for _, c := range ship.ActiveContracts {
+			if c.CorpID == corpID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// InviteToCorp lets a pilot join an invite-only corp. Caller holds dataLock.
+func InviteToCorp(ship *Ship, invitee string) (*Corp, error) {
+	corp, err := requirePerm(ship.PilotID, PermManageMembers)
+	if err != nil {
+		return nil, err
+	}
+	if invitee == "" {
+		return nil, serviceError(http.StatusBadRequest, "Pilot ID required")
+	}
+	corp.Invites[invitee] = true
+	return corp, nil
+}
+
+// SetCorpRole changes a member's role, or removes them if role is empty.
+// Only holders of the founder role may grant or revoke it. Caller holds dataLock.
+func SetCorpRole(ship *Ship, member, role string) (*Corp, error) {
+	corp, err := requirePerm(ship.PilotID, PermManageMembers)
+	if err != nil {
+		return nil, err
+	}
+	current, ok := corp.Members[member]
+	if !ok {
+		return nil, serviceError(http.StatusNotFound, "Not a member")
+	}
+	founder := CurrentUniverse.CorpConfig.FounderRole
+	if (current == founder || role == founder) && corp.Members[ship.PilotID] != founder {
+		return nil, serviceError(http.StatusForbidden, "Only the founder role can manage founders")
+	}
+	if member == ship.PilotID && current == founder && role != founder {
+		return nil, serviceError(http.StatusConflict, "Promote a successor instead of demoting yourself")
+	}
+
+	if role == "" {
+		delete(corp.Members, member)
+		delete(CorpOf, member)
+		return corp, nil
+	}
+	if getCorpRole(role) == nil {
+		return nil, serviceError(http.StatusNotFound, "Role not found")
+	}
+	corp.Members[member] = role
+	return corp, nil
+}
+
+// DepositToCorp moves credits into the treasury. Any member may deposit.
+// Caller holds dataLock.
+func DepositToCorp(ship *Ship, amount int) (*Corp, error) {
+	corp, err := myCorp(ship.PilotID)
+	if err != nil {
+		return nil, err
+	}
+	if amount <= 0 {
+		return nil, serviceError(http.StatusBadRequest, "Amount must be positive")
+	}
+	if err := checkSender(ship.PilotID); err != nil {
+		return nil, err
+	}
+	if ship.Credits < amount {
+		return nil, serviceError(http.StatusPaymentRequired, "Insufficient credits")
+	}
+	moveCredits(ship, -amount, LedgerEntry{Reason: "corp_deposit", Counterparty: corp.ID})
+	corp.record(ship.PilotID, "deposit", amount, "")
+	return corp, nil
+}
+
+// WithdrawFromCorp moves treasury credits to the pilot. The same checks as a
+// deposit apply, and a member sharing a host with another member can't
+// withdraw, so the treasury can't launder credits between one player's
+// accounts. Caller holds dataLock.
+func WithdrawFromCorp(ship *Ship, amount int) (*Corp, error) {
+	if amount <= 0 {
+		return nil, serviceError(http.StatusBadRequest, "Amount must be positive")
+	}
+	if err := checkSender(ship.PilotID); err != nil {
+		return nil, err
+	}
+	if corp, ok := Corps[CorpOf[ship.PilotID]]; ok {
+		for member := range corp.Members {
+			if member != ship.PilotID && sameOrigin(member, ship.PilotID) {
+				return nil, serviceError(http.StatusForbidden, "Another member shares your connection")
+			}
+		}
+	}
+	if err := SpendTreasury(ship.PilotID, PermWithdraw, amount, "withdraw", ""); err != nil {
+		return nil, err
+	}
+	corp := Corps[CorpOf[ship.PilotID]]
+	moveCredits(ship, amount, LedgerEntry{Reason: "corp_withdraw", Counterparty: corp.ID})
+	return corp, nil
+}
+
+// PostCorpContract funds a job from the treasury onto the corp's private board.
+// Caller holds dataLock.
+func PostCorpContract(ship *Ship, req PostContractRequest) (Contract, error) {
+	corp, err := requirePerm(ship.PilotID, PermPostContracts)
+	if err != nil {
+		return Contract{}, err
+	}
+	job, err := newPosting(ship.PilotID, req)
+	if err != nil {
+		return Contract{}, err
+	}
+	if corp.Treasury < job.Escrow {
+		return Contract{}, serviceError(http.StatusPaymentRequired, "Insufficient corp funds")
+	}
+	job.ID = strings.Replace(job.ID, "PLR-", "CRP-", 1)
+	job.CorpID = corp.ID
+	corp.record(ship.PilotID, "contract_posted", -job.Escrow, job.ID)
+	corp.Board = append(corp.Board, job)
+	return job, nil
+}
+
+// AcceptCorpContract loads a corp job docked at its origin. Caller holds dataLock.
+func AcceptCorpContract(ship *Ship, contractID string) (Contract, error) {
+	corp, err := requirePerm(ship.PilotID, PermAcceptContracts)
+	if err != nil {
+		return Contract{}, err
+	}
+	for i, c := range corp.Board {
+		if c.ID != contractID {
+			continue
+		}
+		if c.OriginKey != ship.LocationKey {
+			return Contract{}, serviceError(http.StatusConflict, "Contract is picked up at "+c.OriginKey)
+		}
+		if err := canCarry(ship, c); err != nil {
+			return Contract{}, err
+		}
+		corp.Board = append(corp.Board[:i], corp.Board[i+1:]...)
+		ship.ActiveContracts = append(ship.ActiveContracts, c)
+		return c, nil
+	}
+	return Contract{}, serviceError(http.StatusNotFound, "Contract not found")
+}
+
+// CancelCorpContract pulls an unaccepted corp job and returns its escrow to the
+// treasury. Caller holds dataLock.
+func CancelCorpContract(ship *Ship, contractID string) (Contract, error) {
+	corp, err := requirePerm(ship.PilotID, PermPostContracts)
+	if err != nil {
+		return Contract{}, err
+	}
+	for i, c := range corp.Board {
+		if c.ID == contractID {
+			corp.Board = append(corp.Board[:i], corp.Board[i+1:]...)
+			corp.record(ship.PilotID, "contract_refund", c.Escrow, c.ID)
+			return c, nil
+		}
+	}
+	return Contract{}, serviceError(http.StatusNotFound, "Contract not found")
+}
+
+// CorpContracts lists a corp's jobs: open on its board, and aboard members' ships.
+// Caller holds dataLock.
+func CorpContracts(corp *Corp) []Posting {
+	out := []Posting{}
+	for _, c := range corp.Board {
+		out = append(out, Posting{Contract: c, Status: "open"})
+	}
+	for _, s := range allPlayerShips() {
+		for _, c := range s.ActiveContracts {
+			if c.CorpID == corp.ID {
+				out = append(out, Posting{Contract: c, Status: "in_transit", Carrier: s.PilotID})
+			}
+		}
+	}
+	return out
+}
+
+// PostCorpChat sends a line to every member's connections. Caller holds dataLock.
+func PostCorpChat(ship *Ship, text string) (CorpChatMessage, error) {
+	corp, err := myCorp(ship.PilotID)
+	if err != nil {
+		return CorpChatMessage{}, err
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return CorpChatMessage{}, serviceError(http.StatusBadRequest, "Message is empty")
+	}
+	msg := CorpChatMessage{Time: time.Now().Unix(), PilotID: ship.PilotID, Sender: ship.Name, Text: text}
+	corp.Chat = append(corp.Chat, msg)
+	if max := CurrentUniverse.CorpConfig.ChatSize; max > 0 && len(corp.Chat) > max {
+		corp.Chat = corp.Chat[len(corp.Chat)-max:]
+	}
+	for member := range corp.Members {
+		gameHub.SendToPilot(member, "chat_corp", msg)
+	}
+	return msg, nil
+}
+
+// ListCorps summarises every corporation. Caller holds dataLock.
+func ListCorps() []CorpSummary {
+	out := []CorpSummary{}
+	for _, c := range Corps {
+		out = append(out, CorpSummary{ID: c.ID, Name: c.Name, Tag: c.Tag, Open: c.Open, Members: len(c.Members)})
+	}
+	return out
+}
@@ -0,0 +1,196 @@
+/*
+Package main
+File: crew.go
+Description: Crew hiring. Planets post crew looking for a berth; each has a role
+and a skill level (1-max_skill). The best crew member in each role aboard adds
+their skill to the ship:
+  - pilot:    cuts fuel burn
+  - engineer: cuts cargo lost in transit (handling and incident damage)
+  - purser:   cuts customs inspection odds
+  - medic:    raises passenger satisfaction
+Crew sleep in passenger berths and draw wages every heartbeat; anyone who goes
+unpaid quits.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Crew roles
+const (
+	RolePilot    = "pilot"
+	RoleEngineer = "engineer"
+	RolePurser   = "purser"
+	RoleMedic    = "medic"
+)
+
+// CrewRole is a role from YAML.
+type CrewRole struct {
+	Key            string  `yaml:"key" json:"key"`
+	Name           string  `yaml:"name" json:"name"`
+	Description    string  `yaml:"description" json:"description"`
+	BaseWage       int     `yaml:"base_wage" json:"base_wage"`               // Credits per heartbeat
+	WagePerSkill   int     `yaml:"wage_per_skill" json:"wage_per_skill"`     // Added per skill level
+	EffectPerSkill float64 `yaml:"effect_per_skill" json:"effect_per_skill"` // Fraction (or satisfaction points for medics) per level
+}
+
+// CrewConfig tunes the crew market from YAML.
+type CrewConfig struct {
+	MaxPerPlanet int        `yaml:"max_per_planet" json:"max_per_planet"`
+	MaxSkill     int        `yaml:"max_skill" json:"max_skill"`
+	HireFeeTicks int        `yaml:"hire_fee_ticks" json:"hire_fee_ticks"` // Signing fee = wage * this
+	Names        []string   `yaml:"names" json:"-"`
+	Roles        []CrewRole `yaml:"roles" json:"roles"`
+}
+
+// CrewMember is a hireable or hired crew member.
+type CrewMember struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Role    string `json:"role"`
+	Skill   int    `json:"skill"`
+	Wage    int    `json:"wage"`     // Per heartbeat
+	HireFee int    `json:"hire_fee"` // Paid once on signing
+}
+
+// CrewForHire maps PlanetKey -> crew looking for work. Guarded by dataLock.
+var CrewForHire = make(map[string][]CrewMember)
+
+// getCrewRole finds a role by key.
+func getCrewRole(key string) *CrewRole {
+	for i := range CurrentUniverse.CrewConfig.Roles {
+		if CurrentUniverse.CrewConfig.Roles[i].Key == key {
+			return &CurrentUniverse.CrewConfig.Roles[i]
+		}
+	}
+	return nil
+}
+
+// crewSkill is the best skill aboard in a role (0 if nobody fills it).
+func crewSkill(ship *Ship, role string) int {
+	best := 0
+	for _, m := range ship.Crew {
+		if m.Role == role && m.Skill > best {
+			best = m.Skill
+		}
+	}
+	return best
+}
+
+// crewEffect is a role's bonus aboard a ship: skill * effect_per_skill.
+func crewEffect(ship *Ship, role string) float64 {
+	r := getCrewRole(role)
+	if r == nil {
+		return 0
+	}
+	return float64(crewSkill(ship, role)) * r.EffectPerSkill
+}
+
+// crewReduction turns a role's bonus into a multiplier that cuts something,
+// never below zero.
+func crewReduction(ship *Ship, role string) float64 {
+	cut := crewEffect(ship, role)
+	if cut > 1 {
+		cut = 1
+	}
+	return 1 - cut
+}
+
+// PostCrew adds a candidate to every planet with room on its crew board.
+func PostCrew() {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+
+	cfg := CurrentUniverse.CrewConfig
+	if len(cfg.Roles) == 0 || cfg.MaxSkill <= 0 {
+		return
+	}
+	for _, p := range CurrentUniverse.Planets {
+		if len(CrewForHire[p.Key]) >= cfg.MaxPerPlanet {
+			continue
+		}
+		role := cfg.Roles[rand.Intn(len(cfg.Roles))]
+		skill := 1 + rand.Intn(cfg.MaxSkill)
+		name := fmt.Sprintf("Spacer %d", rand.Intn(900)+100)
+		if len(cfg.Names) > 0 {
+			name = cfg.Names[rand.Intn(len(cfg.Names))]
+		}
+		wage := role.BaseWage + role.WagePerSkill*skill
+		CrewForHire[p.Key] = append(CrewForHire[p.Key], CrewMember{
+			ID:      fmt.Sprintf("CRW-%d-%d", rand.Intn(99999), time.Now().UnixNano()%1000),
+			Name:    name,
+			Role:    role.Key,
+			Skill:   skill,
+			Wage:    wage,
+			HireFee: wage * cfg.HireFeeTicks,
+		})
+	}
+}
+
+// HireCrew signs a crew member from the local board into a free berth.
+// Caller holds dataLock.
+func HireCrew(ship *Ship, crewID string) (CrewMember, error) {
+	board := CrewForHire[ship.LocationKey]
+	for i, m := range board {
+		if m.ID != crewID {
+			continue
+		}
+		_, passengers := shipLoad(ship)
+		if passengers+len(ship.Crew)+1 > ship.PassengerSlots {
+			return CrewMember{}, serviceError(http.StatusConflict, "No free berth")
+		}
+		if ship.Credits < m.HireFee {
+			return CrewMember{}, serviceError(http.StatusPaymentRequired, "Insufficient credits")
+		}
+		moveCredits(ship, -m.HireFee, LedgerEntry{Reason: "crew_hire", Note: m.ID})
+		CrewForHire[ship.LocationKey] = append(board[:i], board[i+1:]...)
+		ship.Crew = append(ship.Crew, m)
+		return m, nil
+	}
+	return CrewMember{}, serviceError(http.StatusNotFound, "Crew member not found")
+}
+
+// DismissCrew lets a crew member go; they look for work at the current planet.
+// Caller holds dataLock.
+func DismissCrew(ship *Ship, crewID string) (CrewMember, error) {
+	for i, m := range ship.Crew {
+		if m.ID != crewID {
+			continue
+		}
+		ship.Crew = append(ship.Crew[:i], ship.Crew[i+1:]...)
+		CrewForHire[ship.LocationKey] = append(CrewForHire[ship.LocationKey], m)
+		return m, nil
+	}
+	return CrewMember{}, serviceError(http.StatusNotFound, "Crew member not aboard")
+}
+
+// PayCrew pays the crew of every player ship their wages from the owner's
+// credits. Crew who can't be paid quit.
+func PayCrew() {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+
+	for _, ship := range allPlayerShips() {
+		if len(ship.Crew) == 0 {
+			continue
+		}
+		withWallet(ship, func() {
+			kept := []CrewMember{}
+			for _, m := range ship.Crew {
+				if ship.Credits < m.Wage {
+					gameHub.SendToPilot(ship.PilotID, "crew_quit", m)
+					continue
+				}
+				moveCredits(ship, -m.Wage, LedgerEntry{Reason: "crew_wages", Note: m.ID})
+				kept = append(kept, m)
+			}
+			ship.Crew = kept
+		})
+		notifyShip(ship)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Package main
+File: customs.go
+Description: Contraband and customs. Goods are banned at a planet if it lists them
+under `banned`, or if they are flagged illegal and the planet has any security at
+all. Jobs smuggling banned goods pay a premium; arriving anywhere with banned goods
+aboard risks an inspection (odds = planet security, cut by concealment modules),
+which confiscates them and fines the pilot.
+*/
+
+package main
+
+import "math/rand"
+
+// CustomsConfig tunes smuggling from YAML.
+type CustomsConfig struct {
+	ContrabandPremium   float64 `yaml:"contraband_premium" json:"contraband_premium"`       // Payout multiplier for smuggling jobs
+	FineMult            float64 `yaml:"fine_mult" json:"fine_mult"`                         // Fine = payout of seized jobs * this
+	ConcealmentPerPoint float64 `yaml:"concealment_per_point" json:"concealment_per_point"` // Inspection odds cut per concealment point
+}
+
+// CustomsReport is the outcome of an inspection on arrival.
+type CustomsReport struct {
+	PlanetKey string     `json:"planet_key"`
+	Seized    []Contract `json:"seized"`
+	Fine      int        `json:"fine"`
+}
+
+// isBanned reports whether a planet forbids a commodity.
+func isBanned(planet *Planet, itemKey string) bool {
+	if planet == nil {
+		return false
+	}
+	for _, k := range planet.Banned {
+		if k == itemKey {
+			return true
+		}
+	}
+	if comm := GetCommodity(itemKey); comm != nil && comm.HasFlag(FlagIllegal) {
+		return planet.Security > 0
+	}
+	return false
+}
+
+// inspectionOdds is the chance a ship is searched on arrival at a planet.
+func inspectionOdds(ship *Ship, planet *Planet) float64 {
+	odds := planet.Security * (1 - CurrentUniverse.CustomsConfig.ConcealmentPerPoint*float64(ship.Concealment))
+	odds *= crewReduction(ship, RolePurser)
+	if odds < 0 {
+		return 0
+	}
+	return odds
+}
+
+// runCustoms rolls an inspection when the ship arrives with goods banned here.
+// Seized jobs leave the hold unpaid and the fine comes off the pilot's credits
+// (never below zero). Returns nil if there was nothing to find or no search.
+// Caller holds dataLock.
+func runCustoms(ship *Ship, planet *Planet, rng *rand.Rand) *CustomsReport {
+	banned := false
+	for _, c := range ship.ActiveContracts {
+		if c.Type == "cargo" && isBanned(planet, c.ItemKey) {
+			banned = true
+			break
+		}
+	}
+	if !banned || rng.Float64() >= inspectionOdds(ship, planet) {
+		return nil
+	}
+
+	report := &CustomsReport{PlanetKey: planet.Key, Seized: []Contract{}}
+	kept := []Contract{}
+	seizedValue := 0
+	for _, c := range ship.ActiveContracts {
+		if c.Type == "cargo" && isBanned(planet, c.ItemKey) {
+			report.Seized = append(report.Seized, c)
+			seizedValue += c.Payout
+			continue
+		}
+		kept = append(kept, c)
+	}
+	ship.ActiveContracts = kept
+
+	for _, c := range report.Seized {
+		if c.PostedBy != "" {
+			refundEscrow(c)
+		}
+		if c.MissionID != "" {
+			AbandonMission(ship, c.MissionID)
+		}
+	}
+
+	adjustStanding(ship.PilotID, factionOf(planet.Key), -CurrentUniverse.ReputationConfig.SmugglingPenalty)
+
+	report.Fine = int(float64(seizedValue) * CurrentUniverse.CustomsConfig.FineMult)
+	if report.Fine > ship.Credits {
+		report.Fine = ship.Credits
+	}
+	moveCredits(ship, -report.Fine, LedgerEntry{Reason: "customs_fine", Note: planet.Key})
+	return report
+}
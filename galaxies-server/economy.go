@@ -0,0 +1,119 @@
+/*
+Package main
+File: economy.go
+Description: Physical planet economies. Every planet holds a stockpile per commodity
+that grows from production, shrinks from consumption, is drawn down when cargo
+contracts are posted and refilled when cargo is delivered. Contract generation
+exports what is actually in the warehouse.
+*/
+
+package main
+
+import "math/rand"
+
+// Global rates come from market_model; planets may override them per commodity
+// with production_rates / consumption_rates.
+
+// productionRate is how many units of a good the planet makes per heartbeat.
+func (p *Planet) productionRate(itemKey string) int {
+	if rate, ok := p.ProductionRates[itemKey]; ok {
+		return rate
+	}
+	if p.Produces(itemKey) {
+		return CurrentUniverse.MarketModel.ProductionRate
+	}
+	return 0
+}
+
+// consumptionRate is how many units of a good the planet uses per heartbeat.
+func (p *Planet) consumptionRate(itemKey string) int {
+	if rate, ok := p.ConsumptionRates[itemKey]; ok {
+		return rate
+	}
+	if p.Demands(itemKey) {
+		return CurrentUniverse.MarketModel.ConsumptionRate
+	}
+	return 0
+}
+
+func (p *Planet) stockpileCap() int {
+	if p.StockpileCap > 0 {
+		return p.StockpileCap
+	}
+	return CurrentUniverse.MarketModel.StockpileCap
+}
+
+// InitStockpiles seeds warehouses for planets/commodities that have none yet, so a
+// config reload keeps the current simulation. Caller holds dataLock.
+func InitStockpiles() {
+	for i := range CurrentUniverse.Planets {
+		p := &CurrentUniverse.Planets[i]
+		if Market.Stockpile[p.Key] == nil {
+			Market.Stockpile[p.Key] = make(map[string]int)
+		}
+		for _, c := range CurrentUniverse.Commodities {
+			if _, ok := Market.Stockpile[p.Key][c.Key]; ok {
+				continue
+			}
+			if p.productionRate(c.Key) > 0 {
+				Market.Stockpile[p.Key][c.Key] = CurrentUniverse.MarketModel.StartingStock
+			} else {
+				Market.Stockpile[p.Key][c.Key] = 0
+			}
+		}
+	}
+}
+
+// EconomyTick runs one heartbeat of production and consumption. Caller holds dataLock.
+func EconomyTick() {
+	for i := range CurrentUniverse.Planets {
+		p := &CurrentUniverse.Planets[i]
+		stock := Market.Stockpile[p.Key]
+		for _, c := range CurrentUniverse.Commodities {
+			units := stock[c.Key] + p.productionRate(c.Key) - p.consumptionRate(c.Key)
+			if units < 0 {
+				units = 0
+			}
+			if units > p.stockpileCap() {
+				units = p.stockpileCap()
+			}
+			stock[c.Key] = units
+		}
+	}
+}
+
+// pickExport chooses a commodity to ship out of a planet, weighted by how much of
+// each is in stock. Returns nil if the warehouse is empty.
+func pickExport(planetKey string) *Commodity {
+	stock := Market.Stockpile[planetKey]
+	total := 0
+	for _, c := range CurrentUniverse.Commodities {
+		total += stock[c.Key]
+	}
+	if total == 0 {
+		return nil
+	}
+
+	roll := rand.Intn(total)
+	for i := range CurrentUniverse.Commodities {
+		c := &CurrentUniverse.Commodities[i]
+		if roll < stock[c.Key] {
+			return c
+		}
+		roll -= stock[c.Key]
+	}
+	return nil
+}
+
+// AddStock puts delivered goods into a planet's warehouse (capped). Caller holds dataLock.
+func AddStock(planetKey, itemKey string, qty int) {
+	stock := Market.Stockpile[planetKey]
+	if stock == nil {
+		return
+	}
+	units := stock[itemKey] + qty
+	if p := GetPlanet(planetKey); p != nil && units > p.stockpileCap() {
+		units = p.stockpileCap()
+	}
+	stock[itemKey] = units
+}
@@ -0,0 +1,248 @@
+/*
+Package main
+File: events.go
+Description: Galactic events. Each heartbeat may trigger one of the events defined
+in universe.yaml (strikes, plagues, festivals, blockades, flares) at a planet. While
+active, an event shifts market heat, contract payouts, fuel prices and jump costs
+there. Starts and ends are broadcast as "galactic_event" messages.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// EventConfig controls how often events fire.
+type EventConfig struct {
+	ChancePerTick float64 `yaml:"chance_per_tick" json:"chance_per_tick"` // 0.0-1.0 per heartbeat
+	MaxActive     int     `yaml:"max_active" json:"max_active"`           // Concurrent events cap
+}
+
+// EventEffects describes what an event does to its planet. Zero multipliers mean "no change".
+type EventEffects struct {
+	Commodities    []string `yaml:"commodities" json:"commodities"`           // Goods whose heat shifts (empty = all)
+	SourceHeat     float64  `yaml:"source_heat" json:"source_heat"`           // Added once to source heat on start
+	DestHeat       float64  `yaml:"dest_heat" json:"dest_heat"`               // Added once to dest heat on start (negative = shortage, higher payouts)
+	PayoutMult     float64  `yaml:"payout_mult" json:"payout_mult"`           // Contracts to/from the planet
+	FuelPriceMult  float64  `yaml:"fuel_price_mult" json:"fuel_price_mult"`   // Refuelling at the planet
+	TravelCostMult float64  `yaml:"travel_cost_mult" json:"travel_cost_mult"` // Jumps to/from the planet
+	RiskMult       float64  `yaml:"risk_mult" json:"risk_mult"`               // Transit incident odds on jumps to/from the planet
+}
+
+// GalacticEvent is an event template from YAML.
+type GalacticEvent struct {
+	Key           string       `yaml:"key" json:"key"`
+	Name          string       `yaml:"name" json:"name"`
+	Description   string       `yaml:"description" json:"description"`
+	DurationTicks int          `yaml:"duration_ticks" json:"duration_ticks"` // Heartbeats the event lasts
+	Weight        int          `yaml:"weight" json:"weight"`                 // Relative odds
+	Planets       []string     `yaml:"planets" json:"planets"`               // Candidate planets (empty = any)
+	Effects       EventEffects `yaml:"effects" json:"effects"`
+}
+
+// ActiveEvent is a running event at a specific planet.
+type ActiveEvent struct {
+	ID             string       `json:"id"`
+	Key            string       `json:"key"`
+	Name           string       `json:"name"`
+	Description    string       `json:"description"`
+	PlanetKey      string       `json:"planet_key"`
+	StartedAt      int64        `json:"started_at"` // Unix seconds
+	RemainingTicks int          `json:"remaining_ticks"`
+	Effects        EventEffects `json:"effects"`
+}
+
+// ActiveEvents is guarded by dataLock.
+var ActiveEvents = []ActiveEvent{}
+
+// EventTick ages running events and may start a new one.
+// Returns the events that started and ended this tick.
+func EventTick() (started, ended []ActiveEvent) {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+
+	remaining := []ActiveEvent{}
+	for _, e := range ActiveEvents {
+		e.RemainingTicks--
+		if e.RemainingTicks <= 0 {
+			ended = append(ended, e)
+			continue
+		}
+		remaining = append(remaining, e)
+	}
+	ActiveEvents = remaining
+	if len(ended) > 0 {
+		repriceBoards()
+	}
+
+	cfg := CurrentUniverse.EventConfig
+	if len(ActiveEvents) < cfg.MaxActive && rand.Float64() < cfg.ChancePerTick {
+		if e, ok := startRandomEvent(); ok {
+			started = append(started, e)
+		}
+	}
+	return started, ended
+}
+
+// startRandomEvent picks a weighted template and a planet not already hit by it.
+// Caller holds dataLock.
+func startRandomEvent() (ActiveEvent, bool) {
+	templates := CurrentUniverse.GalacticEvents
+	total := 0
+	for _, t := range templates {
+		total += t.Weight
+	}
+	if total <= 0 {
+		return ActiveEvent{}, false
+	}
+
+	roll := rand.Intn(total)
+	var tmpl GalacticEvent
+	for _, t := range templates {
+		if roll < t.Weight {
+			tmpl = t
+			break
+		}
+		roll -= t.Weight
+	}
+
+	candidates := []string{}
+	pool := tmpl.Planets
+	if len(pool) == 0 {
+		for _, p := range CurrentUniverse.Planets {
+			pool = append(pool, p.Key)
+		}
+	}
+	for _, key := range pool {
+		busy := false
+		for _, e := range ActiveEvents {
+			if e.Key == tmpl.Key && e.PlanetKey == key {
+				busy = true
+				break
+			}
+		}
+		if !busy && GetPlanet(key) != nil {
+			candidates = append(candidates, key)
+		}
+	}
+	if len(candidates) == 0 {
+		return ActiveEvent{}, false
+	}
+
+	e := ActiveEvent{
+		ID:             fmt.Sprintf("EVT-%d-%d", rand.Intn(99999), time.Now().UnixNano()%1000),
+		Key:            tmpl.Key,
+		Name:           tmpl.Name,
+		Description:    tmpl.Description,
+		PlanetKey:      candidates[rand.Intn(len(candidates))],
+		StartedAt:      time.Now().Unix(),
+		RemainingTicks: tmpl.DurationTicks,
+		Effects:        tmpl.Effects,
+	}
+	ActiveEvents = append(ActiveEvents, e)
+	applyEventStart(e)
+	return e, true
+}
+
+// applyEventStart shifts heat and reprices the open contracts (the next market
+// pulse carries the price changes). Caller holds dataLock and has added e to
+// ActiveEvents.
+func applyEventStart(e ActiveEvent) {
+	model := CurrentUniverse.MarketModel
+	for _, c := range CurrentUniverse.Commodities {
+		if !e.Effects.affects(c.Key) {
+			continue
+		}
+		if heat, ok := Market.SourceHeat[e.PlanetKey]; ok && e.Effects.SourceHeat != 0 {
+			heat[c.Key] = model.clamp(heat[c.Key] + e.Effects.SourceHeat)
+		}
+		if heat, ok := Market.DestHeat[e.PlanetKey]; ok && e.Effects.DestHeat != 0 {
+			heat[c.Key] = model.clamp(heat[c.Key] + e.Effects.DestHeat)
+		}
+	}
+
+	if e.Effects.PayoutMult != 0 {
+		repriceBoards()
+	}
+}
+
+// repriceBoards swaps the event multiplier baked into each generated job for
+// the one from the events running now, so an event's payout change is undone
+// when it ends. Player and corp postings are funded by escrow and never
+// repriced. Caller holds dataLock.
+func repriceBoards() {
+	for _, board := range AvailableContracts {
+		for i := range board {
+			c := &board[i]
+			if c.eventMult == 0 || c.PostedBy != "" || c.CorpID != "" {
+				continue
+			}
+			mult := EventPayoutMult(c.OriginKey, c.DestinationKey)
+			if mult != c.eventMult {
+				c.Payout = int(float64(c.Payout) / c.eventMult * mult)
+				c.eventMult = mult
+			}
+		}
+	}
+}
+
+// affects reports whether the effects touch a commodity's heat.
+func (fx EventEffects) affects(itemKey string) bool {
+	if len(fx.Commodities) == 0 {
+		return true
+	}
+	for _, k := range fx.Commodities {
+		if k == itemKey {
+			return true
+		}
+	}
+	return false
+}
+
+// eventMult multiplies one effect across every active event at the planet.
+// Caller holds dataLock.
+func eventMult(planetKey string, pick func(EventEffects) float64) float64 {
+	mult := 1.0
+	for _, e := range ActiveEvents {
+		if e.PlanetKey == planetKey {
+			if m := pick(e.Effects); m != 0 {
+				mult *= m
+			}
+		}
+	}
+	return mult
+}
+
+// EventPayoutMult applies to new contracts between two planets.
+func EventPayoutMult(originKey, destKey string) float64 {
+	pick := func(fx EventEffects) float64 { return fx.PayoutMult }
+	return eventMult(originKey, pick) * eventMult(destKey, pick)
+}
+
+// EventFuelPriceMult applies to refuelling at a planet.
+func EventFuelPriceMult(planetKey string) float64 {
+	return eventMult(planetKey, func(fx EventEffects) float64 { return fx.FuelPriceMult })
+}
+
+// EventTravelCostMult applies to fuel burned on a jump between two planets.
+func EventTravelCostMult(originKey, destKey string) float64 {
+	pick := func(fx EventEffects) float64 { return fx.TravelCostMult }
+	return eventMult(originKey, pick) * eventMult(destKey, pick)
+}
+
+// broadcastEvent tells every client an event started or ended.
+func broadcastEvent(status string, e ActiveEvent) {
+	data, err := json.Marshal(Message{
+		Type:    "galactic_event",
+		Payload: map[string]interface{}{"status": status, "event": e},
+		Sender:  "SERVER",
+	})
+	if err != nil {
+		return
+	}
+	gameHub.Broadcast(data)
+}
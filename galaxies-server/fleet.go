@@ -0,0 +1,259 @@
+/*
+Package main
+File: fleet.go
+Description: Fleet ownership. A player can buy more ships at the shipyard and
+switch which one they fly. The flown ship is the one in Pilots and holds the
+player's credits; the rest sit idle or run an automated route: every heartbeat
+an automated ship refuels, patches itself up, takes the jobs bound for its next
+stop and flies there, using the same services as a player. Automated ships spend
+and earn from the owner's credits, so a fleet can make or lose money offline.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ShipClass is a hull for sale at the shipyard.
+type ShipClass struct {
+	Key         string `yaml:"key" json:"key"`
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description"`
+	Price       int    `yaml:"price" json:"price"`
+	Ship        Ship   `yaml:"ship" json:"ship"` // Same fields as player_ship
+}
+
+// FleetConfig tunes fleets from YAML.
+type FleetConfig struct {
+	MaxShips        int         `yaml:"max_ships" json:"max_ships"`
+	Shipyard        string      `yaml:"shipyard" json:"shipyard"`                   // Planet selling ships
+	AutoRepairBelow float64     `yaml:"auto_repair_below" json:"auto_repair_below"` // Automated ships repair when a part drops below this
+	Classes         []ShipClass `yaml:"classes" json:"classes"`
+}
+
+// Automation is an automated ship's route and running totals.
+type Automation struct {
+	Stops     []string `json:"stops"`
+	Next      int      `json:"next"`   // Index in Stops of the next destination
+	Status    string   `json:"status"` // "running" or "stalled"
+	LastError string   `json:"last_error,omitempty"`
+	Trips     int      `json:"trips"`
+	Earned    int      `json:"earned"` // Payouts
+	Spent     int      `json:"spent"`  // Fuel and repairs
+}
+
+// FleetResponse is the response of /api/fleet.
+type FleetResponse struct {
+	ActiveShipID string  `json:"active_ship_id"`
+	MaxShips     int     `json:"max_ships"`
+	Ships        []*Ship `json:"ships"`
+}
+
+// Fleets maps PilotID -> every ship the player owns, the flown one included.
+// Guarded by dataLock.
+var Fleets = make(map[string][]*Ship)
+
+// getShipClass finds a hull by key.
+func getShipClass(key string) *ShipClass {
+	for i := range CurrentUniverse.FleetConfig.Classes {
+		if CurrentUniverse.FleetConfig.Classes[i].Key == key {
+			return &CurrentUniverse.FleetConfig.Classes[i]
+		}
+	}
+	return nil
+}
+
+// addToFleet registers a ship with its owner and gives it an ID.
+func addToFleet(ship *Ship) {
+	fleet := Fleets[ship.PilotID]
+	ship.ShipID = fmt.Sprintf("%s-%d", ship.PilotID, len(fleet)+1)
+	Fleets[ship.PilotID] = append(fleet, ship)
+}
+
+// fleetShip finds one of a player's ships.
+func fleetShip(pilotID, shipID string) (*Ship, error) {
+	for _, s := range Fleets[pilotID] {
+		if s.ShipID == shipID {
+			return s, nil
+		}
+	}
+	return nil, serviceError(http.StatusNotFound, "Ship not in your fleet")
+}
+
+// allPlayerShips lists every player-owned ship, flown or not.
+func allPlayerShips() []*Ship {
+	out := []*Ship{}
+	for _, fleet := range Fleets {
+		out = append(out, fleet...)
+	}
+	return out
+}
+
+// withWallet runs fn with the owner's credits aboard a ship that isn't the one
+// they fly, so services can charge and pay it as usual. Caller holds dataLock.
+func withWallet(ship *Ship, fn func()) {
+	active, ok := Pilots[ship.PilotID]
+	if !ok || active == ship {
+		fn()
+		return
+	}
+	ship.Credits, active.Credits = active.Credits, 0
+	fn()
+	active.Credits, ship.Credits = ship.Credits, 0
+}
+
+// GetFleet lists a player's ships. Caller holds dataLock.
+func GetFleet(ship *Ship) FleetResponse {
+	return FleetResponse{
+		ActiveShipID: ship.ShipID,
+		MaxShips:     CurrentUniverse.FleetConfig.MaxShips,
+		Ships:        Fleets[ship.PilotID],
+	}
+}
+
+// BuyShip buys a hull at the shipyard; it is delivered there, idle.
+// Caller holds dataLock.
+func BuyShip(ship *Ship, classKey string) (*Ship, error) {
+	cfg := CurrentUniverse.FleetConfig
+	if ship.LocationKey != cfg.Shipyard {
+		return nil, serviceError(http.StatusForbidden, "No shipyard at this location")
+	}
+	class := getShipClass(classKey)
+	if class == nil {
+		return nil, serviceError(http.StatusNotFound, "Ship class not found")
+	}
+	if len(Fleets[ship.PilotID]) >= cfg.MaxShips {
+		return nil, serviceError(http.StatusConflict, "Fleet is at its maximum size")
+	}
+	price := int(float64(class.Price) * standingPriceMult(ship.PilotID, ship.LocationKey))
+	if ship.Credits < price {
+		return nil, serviceError(http.StatusPaymentRequired, "Insufficient credits")
+	}
+
+	moveCredits(ship, -price, LedgerEntry{Reason: "ship_purchase", Note: class.Key})
+	bought := commission(class.Ship, ship.PilotID)
+	bought.Credits = 0
+	bought.LocationKey = ship.LocationKey
+	addToFleet(bought)
+	return bought, nil
+}
+
+// SwitchShip hands the controls (and credits) to another ship in the fleet,
+// taking it off automation. Returns the newly flown ship. Caller holds dataLock.
+func SwitchShip(ship *Ship, shipID string) (*Ship, error) {
+	target, err := fleetShip(ship.PilotID, shipID)
+	if err != nil {
+		return nil, err
+	}
+	if target == ship {
+		return nil, serviceError(http.StatusBadRequest, "Already flying that ship")
+	}
+	target.Automation = nil
+	target.Credits, ship.Credits = ship.Credits, 0
+	Pilots[ship.PilotID] = target
+	return target, nil
+}
+
+// SetRoute puts an idle ship on an automated route between planets, or takes
+// it off automation if stops is empty. Caller holds dataLock.
+func SetRoute(ship *Ship, shipID string, stops []string) (*Ship, error) {
+	target, err := fleetShip(ship.PilotID, shipID)
+	if err != nil {
+		return nil, err
+	}
+	if target == ship {
+		return nil, serviceError(http.StatusConflict, "Cannot automate the ship you are flying")
+	}
+	if len(stops) == 0 {
+		target.Automation = nil
+		return target, nil
+	}
+	if len(stops) < 2 {
+		return nil, serviceError(http.StatusBadRequest, "A route needs at least two stops")
+	}
+	for i, key := range stops {
+		if GetPlanet(key) == nil {
+			return nil, serviceError(http.StatusNotFound, "Route stop not found: "+key)
+		}
+		if key == stops[(i+1)%len(stops)] {
+			return nil, serviceError(http.StatusBadRequest, "Consecutive stops must differ")
+		}
+	}
+
+	target.Automation = &Automation{Stops: append([]string{}, stops...), Status: "running"}
+	return target, nil
+}
+
+// FleetTick flies every automated ship one hop along its route.
+func FleetTick() {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+
+	for pilotID, fleet := range Fleets {
+		active := Pilots[pilotID]
+		for _, ship := range fleet {
+			if ship == active || ship.Automation == nil {
+				continue
+			}
+			withWallet(ship, func() { runRoute(ship) })
+			notifyShip(ship)
+		}
+	}
+}
+
+// runRoute is one heartbeat of an automated ship. Caller holds dataLock and
+// the owner's wallet is aboard.
+func runRoute(ship *Ship) {
+	a := ship.Automation
+	cfg := CurrentUniverse.FleetConfig
+
+	// 1. Refuel and patch up where possible
+	if ship.Fuel < ship.MaxFuel/2 {
+		if cost, err := RefuelShip(ship); err == nil {
+			a.Spent += cost
+		}
+	}
+	if ship.HullCondition < cfg.AutoRepairBelow || ship.EngineCondition < cfg.AutoRepairBelow {
+		if cost, err := RepairShip(ship, ""); err == nil {
+			a.Spent += cost
+		}
+	}
+
+	// 2. Take every job bound for the next stop that fits
+	if a.Stops[a.Next] == ship.LocationKey {
+		a.Next = (a.Next + 1) % len(a.Stops)
+	}
+	next := a.Stops[a.Next]
+	ids := []string{}
+	for _, c := range AvailableContracts[ship.LocationKey] {
+		if c.DestinationKey == next {
+			ids = append(ids, c.ID)
+		}
+	}
+	for _, id := range ids {
+		AcceptContract(ship, id)
+	}
+
+	// 3. Fly (presence follows the pilot's flown ship, so stored ships stay off the map)
+	result, err := TravelShip(ship, next)
+	if err != nil {
+		if a.Status != "stalled" {
+			gameHub.SendToPilot(ship.PilotID, "fleet_stalled", map[string]string{
+				"ship_id": ship.ShipID,
+				"name":    ship.Name,
+				"error":   err.Error(),
+			})
+		}
+		a.Status = "stalled"
+		a.LastError = err.Error()
+		return
+	}
+	a.Status = "running"
+	a.LastError = ""
+	a.Trips++
+	a.Earned += result.Payout
+	a.Next = (a.Next + 1) % len(a.Stops)
+	notifyPosters(result.Delivered)
+}
@@ -1,8 +1,8 @@
 /*
 Package main
 File: handlers.go
-Description: HTTP Handlers for the API. Includes logic for accepting contracts,
-traveling, refueling, and buying modules. Now hooks into MarketState.
+Description: HTTP Handlers for the API. Accepting contracts, traveling and refueling
+go through the shared rules in services.go; buying modules lives here.
 */
 
 package main
@@ -10,6 +10,7 @@ package main
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 )
 
 type TravelRequest struct {
@@ -22,6 +23,76 @@ type ContractRequest struct {
 
 type BuyModuleRequest struct {
 	ModuleKey string `json:"module_key"`
+	CorpFunds bool   `json:"corp_funds"` // Pay from the corp treasury (needs buy_modules)
+}
+
+type MissionRequest struct {
+	MissionID string `json:"mission_id"`
+}
+
+type BankRequest struct {
+	Amount int `json:"amount"` // Repay: 0 repays as much as possible
+}
+
+type TowRequest struct {
+	DestinationKey string `json:"destination_key"` // Optional; defaults to the bank's tow yard
+}
+
+type RepairRequest struct {
+	Part string `json:"part"` // "hull", "engine", or empty for both
+}
+
+type CrewRequest struct {
+	CrewID string `json:"crew_id"`
+}
+
+// CrewResponse is the local crew board and the ship's roster.
+type CrewResponse struct {
+	ForHire []CrewMember `json:"for_hire"`
+	Roster  []CrewMember `json:"roster"`
+	Roles   []CrewRole   `json:"roles"`
+}
+
+// CorpRequest covers every corp action; each endpoint reads the fields it needs.
+type CorpRequest struct {
+	CorpID     string `json:"corp_id"`
+	PilotID    string `json:"pilot_id"` // Invite, kick and role changes
+	Role       string `json:"role"`
+	Amount     int    `json:"amount"`
+	ContractID string `json:"contract_id"`
+	Text       string `json:"text"`
+}
+
+// CorpResponse is the pilot's corporation as a member sees it.
+type CorpResponse struct {
+	Corp  *Corp      `json:"corp"`
+	Role  string     `json:"role"`
+	Roles []CorpRole `json:"roles"`
+}
+
+type BuyShipRequest struct {
+	ClassKey string `json:"class_key"`
+}
+
+type FleetRequest struct {
+	ShipID string   `json:"ship_id"`
+	Stops  []string `json:"stops"` // Route only; empty recalls the ship
+}
+
+type BidRequest struct {
+	AuctionID string `json:"auction_id"`
+	Amount    int    `json:"amount"`
+}
+
+// notifyShip pushes the ship's new state to the pilot's connections so every
+// window stays in sync without polling /api/ship. Ships the pilot isn't flying
+// go out as fleet updates. Caller holds dataLock.
+func notifyShip(ship *Ship) {
+	if active, ok := Pilots[ship.PilotID]; ok && active != ship {
+		gameHub.SendToPilot(ship.PilotID, "fleet_ship_updated", ship)
+		return
+	}
+	gameHub.SendToPilot(ship.PilotID, "ship_updated", ship)
 }
 
 func handleGetPlanets(w http.ResponseWriter, r *http.Request) {
@@ -32,17 +103,19 @@ func handleGetPlanets(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleGetShip(w http.ResponseWriter, r *http.Request) {
-	dataLock.RLock()
-	defer dataLock.RUnlock()
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(PlayerShip)
+	json.NewEncoder(w).Encode(ship)
 }
 
 func handleGetContracts(w http.ResponseWriter, r *http.Request) {
-	dataLock.RLock()
-	defer dataLock.RUnlock()
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(AvailableContracts[PlayerShip.LocationKey])
+	json.NewEncoder(w).Encode(AvailableContracts[ship.LocationKey])
 }
 
 // handleAcceptContract moves a contract to the ship and triggers Market Scarcity.
@@ -55,67 +128,17 @@ func handleAcceptContract(w http.ResponseWriter, r *http.Request) {
 
 	dataLock.Lock()
 	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
 
-	board := AvailableContracts[PlayerShip.LocationKey]
-	var target Contract
-	foundIdx := -1
-
-	for i, c := range board {
-		if c.ID == req.ContractID {
-			target = c
-			foundIdx = i
-			break
-		}
-	}
-
-	if foundIdx == -1 {
-		http.Error(w, "Contract not found", http.StatusNotFound)
-		return
-	}
-
-	// Capacity Logic
-	currentCargo, currentPass := 0, 0
-	for _, ac := range PlayerShip.ActiveContracts {
-		if ac.Type == "cargo" {
-			currentCargo += ac.Quantity
-		} else {
-			currentPass += ac.Quantity
-		}
-	}
-
-	if target.Type == "cargo" && currentCargo+target.Quantity > PlayerShip.CargoCapacity {
-		http.Error(w, "Insufficient Cargo Space", http.StatusConflict)
-		return
-	}
-	if target.Type == "passenger" && currentPass+target.Quantity > PlayerShip.PassengerSlots {
-		http.Error(w, "Insufficient Passenger Slots", http.StatusConflict)
+	if _, err := AcceptContract(ship, req.ContractID); err != nil {
+		writeServiceError(w, err)
 		return
 	}
 
-	// 1. Add to Ship
-	PlayerShip.ActiveContracts = append(PlayerShip.ActiveContracts, target)
-
-	// 2. Remove from Board
-	AvailableContracts[PlayerShip.LocationKey] = append(board[:foundIdx], board[foundIdx+1:]...)
-
-	// 3. MARKET EVENT: Record Acceptance (Increase Scarcity at Origin)
-	// We release the lock briefly or handle this inside the locked context.
-	// Since Market struct is global and has its own maps, we can call the method directly.
-	// Note: We are already holding dataLock, so we must be careful if MarketState methods use dataLock.
-	// In the state.go implementation, RecordAcceptance USES dataLock.
-	// To avoid Deadlock, we should perform the market update AFTER unlocking,
-	// OR remove the lock from RecordAcceptance if it's only called from here.
-	// FIX: For safety in this simple implementation, we will manually update the map here
-	// to avoid recursive locking issues, or we assume MarketState uses a separate lock.
-	// For MVP simplicity: We will modify the map directly here since we hold dataLock.
-
-	if Market.SourceHeat[target.OriginKey] != nil {
-		impact := float64(target.Quantity) * 0.01
-		Market.SourceHeat[target.OriginKey][target.ItemKey] += impact
-	}
+	notifyShip(ship)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(PlayerShip)
+	json.NewEncoder(w).Encode(ship)
 }
 
 // handleTravel moves the ship and triggers Market Saturation on delivery.
@@ -128,81 +151,76 @@ func handleTravel(w http.ResponseWriter, r *http.Request) {
 
 	dataLock.Lock()
 	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
 
-	dest := GetPlanet(req.DestinationKey)
-	current := GetPlanet(PlayerShip.LocationKey)
-	if dest == nil {
-		http.Error(w, "Destination invalid", http.StatusNotFound)
+	result, err := TravelShip(ship, req.DestinationKey)
+	if err != nil {
+		writeServiceError(w, err)
 		return
 	}
+	announceArrival(ship, result)
 
-	dist := CalculateDistance(current.Coordinates, dest.Coordinates)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ship)
+}
 
-	currentBurn := CalculateCurrentBurn()
-	fuelNeeded := dist * currentBurn
+// announceArrival shows the pilot's jump in hub presence and pushes everything
+// that happened on arrival. Caller holds dataLock.
+func announceArrival(ship *Ship, result TravelResult) {
+	gameHub.JumpPilot(ship.PilotID, result.Origin, ship.LocationKey, result.Quote.Distance)
 
-	if PlayerShip.Fuel < fuelNeeded {
-		http.Error(w, "Insufficient Fuel for current mass", http.StatusPaymentRequired)
-		return
+	for _, c := range result.Delivered {
+		gameHub.SendToPilot(ship.PilotID, "contract_delivered", c)
 	}
-
-	PlayerShip.Fuel -= fuelNeeded
-	PlayerShip.LocationKey = dest.Key
-
-	// Handle automatic delivery upon arrival
-	remainingContracts := []Contract{}
-	payoutTotal := 0
-
-	for _, c := range PlayerShip.ActiveContracts {
-		if c.DestinationKey == PlayerShip.LocationKey {
-			payoutTotal += c.Payout
-
-			// MARKET EVENT: Record Delivery (Increase Saturation at Destination)
-			// Direct map access to avoid recursive locking
-			if Market.DestHeat[c.DestinationKey] != nil {
-				impact := float64(c.Quantity) * 0.02
-				Market.DestHeat[c.DestinationKey][c.ItemKey] += impact
-			}
-
-		} else {
-			remainingContracts = append(remainingContracts, c)
-		}
+	notifyPosters(result.Delivered)
+	for _, inc := range result.Incidents {
+		gameHub.SendToPilot(ship.PilotID, "cargo_incident", inc)
+	}
+	for _, inc := range result.Transit {
+		gameHub.SendToPilot(ship.PilotID, "transit_incident", inc)
+	}
+	if result.Customs != nil {
+		gameHub.SendToPilot(ship.PilotID, "customs_inspection", result.Customs)
+	}
+	if result.Claim > 0 {
+		gameHub.SendToPilot(ship.PilotID, "insurance_claim", map[string]int{"amount": result.Claim})
+	}
+	for _, p := range result.Missions {
+		gameHub.SendToPilot(ship.PilotID, "mission_updated", p)
+	}
+	if result.Payout > 0 {
+		gameHub.SendToPilot(ship.PilotID, "payout_received", map[string]int{
+			"amount":    result.Payout,
+			"garnished": result.Garnished,
+			"credits":   ship.Credits,
+		})
 	}
-	PlayerShip.ActiveContracts = remainingContracts
-	PlayerShip.Credits += payoutTotal
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(PlayerShip)
+	notifyShip(ship)
 }
 
 func handleRefuel(w http.ResponseWriter, r *http.Request) {
 	dataLock.Lock()
 	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
 
-	fuelNeeded := PlayerShip.MaxFuel - PlayerShip.Fuel
-	if fuelNeeded <= 0 {
-		http.Error(w, "Tank is already full", http.StatusBadRequest)
-		return
-	}
-
-	cost := (int(fuelNeeded) / 100) * CurrentUniverse.BalanceConfig.FuelCostPerUnit
-	if PlayerShip.Credits < cost {
-		http.Error(w, "Insufficient credits", http.StatusForbidden)
+	if _, err := RefuelShip(ship); err != nil {
+		writeServiceError(w, err)
 		return
 	}
 
-	PlayerShip.Credits -= cost
-	PlayerShip.Fuel = PlayerShip.MaxFuel
+	notifyShip(ship)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(PlayerShip)
+	json.NewEncoder(w).Encode(ship)
 }
 
 func handleGetModules(w http.ResponseWriter, r *http.Request) {
-	dataLock.RLock()
-	defer dataLock.RUnlock()
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
 	w.Header().Set("Content-Type", "application/json")
-	if PlayerShip.LocationKey != "planet_prime" {
+	if ship.LocationKey != "planet_prime" {
 		json.NewEncoder(w).Encode([]ShipModule{})
 		return
 	}
@@ -218,12 +236,13 @@ func handleBuyModule(w http.ResponseWriter, r *http.Request) {
 
 	dataLock.Lock()
 	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
 
-	if PlayerShip.LocationKey != "planet_prime" {
+	if ship.LocationKey != "planet_prime" {
 		http.Error(w, "Upgrade service unavailable at this location", http.StatusForbidden)
 		return
 	}
-	if len(PlayerShip.InstalledModules) >= PlayerShip.MaxModuleSlots {
+	if len(ship.InstalledModules) >= ship.MaxModuleSlots {
 		http.Error(w, "No module slots available", http.StatusConflict)
 		return
 	}
@@ -232,31 +251,39 @@ func handleBuyModule(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Module not found", http.StatusNotFound)
 		return
 	}
-	if PlayerShip.Credits < mod.Cost {
+	cost := int(float64(mod.Cost) * standingPriceMult(ship.PilotID, ship.LocationKey))
+	if req.CorpFunds {
+		if err := SpendTreasury(ship.PilotID, PermBuyModules, cost, "module_purchase", mod.Key); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+	} else if ship.Credits < cost {
 		http.Error(w, "Insufficient Credits", http.StatusPaymentRequired)
 		return
+	} else {
+		moveCredits(ship, -cost, LedgerEntry{Reason: "module_purchase", ModuleKey: mod.Key})
+	}
+	installed := *mod
+	if req.CorpFunds {
+		installed.CorpID = CorpOf[ship.PilotID]
 	}
+	ship.InstalledModules = append(ship.InstalledModules, installed)
 
-	PlayerShip.Credits -= mod.Cost
-	PlayerShip.InstalledModules = append(PlayerShip.InstalledModules, *mod)
+	applyModuleStats(ship, installed, 1)
 
-	switch mod.StatModifier {
-	case "cargo_capacity":
-		PlayerShip.CargoCapacity += mod.StatValue
-	case "passenger_slots":
-		PlayerShip.PassengerSlots += mod.StatValue
-	}
+	notifyShip(ship)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(PlayerShip)
+	json.NewEncoder(w).Encode(ship)
 }
 
 // New Struct for the Quote Response
 type TravelQuoteResponse struct {
-	Distance  int64 `json:"distance"`
-	FuelCost  int64 `json:"fuel_cost"`
-	CanAfford bool  `json:"can_afford"`
-	BurnRate  int64 `json:"burn_rate"`
+	Distance  int64   `json:"distance"`
+	FuelCost  int64   `json:"fuel_cost"`
+	CanAfford bool    `json:"can_afford"`
+	BurnRate  int64   `json:"burn_rate"`
+	Risk      float64 `json:"risk"` // Odds of a transit incident
 }
 
 func handleTravelQuote(w http.ResponseWriter, r *http.Request) {
@@ -266,25 +293,22 @@ func handleTravelQuote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dataLock.RLock()
-	defer dataLock.RUnlock()
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
 
-	dest := GetPlanet(req.DestinationKey)
-	current := GetPlanet(PlayerShip.LocationKey)
-	if dest == nil {
-		http.Error(w, "Destination invalid", http.StatusNotFound)
+	quote, err := QuoteTravel(ship, req.DestinationKey)
+	if err != nil {
+		writeServiceError(w, err)
 		return
 	}
 
-	dist := CalculateDistance(current.Coordinates, dest.Coordinates)
-	currentBurn := CalculateCurrentBurn()
-	fuelNeeded := dist * currentBurn
-
 	resp := TravelQuoteResponse{
-		Distance:  dist,
-		FuelCost:  fuelNeeded,
-		CanAfford: PlayerShip.Fuel >= fuelNeeded,
-		BurnRate:  currentBurn,
+		Distance:  quote.Distance,
+		FuelCost:  quote.FuelCost,
+		CanAfford: ship.Fuel >= quote.FuelCost,
+		BurnRate:  quote.BurnRate,
+		Risk:      quote.Risk,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -300,9 +324,10 @@ func handleDropContract(w http.ResponseWriter, r *http.Request) {
 
 	dataLock.Lock()
 	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
 
 	foundIdx := -1
-	for i, c := range PlayerShip.ActiveContracts {
+	for i, c := range ship.ActiveContracts {
 		if c.ID == req.ContractID {
 			foundIdx = i
 			break
@@ -314,8 +339,945 @@ func handleDropContract(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	PlayerShip.ActiveContracts = append(PlayerShip.ActiveContracts[:foundIdx], PlayerShip.ActiveContracts[foundIdx+1:]...)
+	dropped := ship.ActiveContracts[foundIdx]
+	ship.ActiveContracts = append(ship.ActiveContracts[:foundIdx], ship.ActiveContracts[foundIdx+1:]...)
+	if dropped.PostedBy != "" {
+		refundEscrow(dropped)
+	}
+	if dropped.MissionID != "" {
+		AbandonMission(ship, dropped.MissionID) // A chain can't continue without this leg
+	}
+	adjustStanding(ship.PilotID, dropped.Faction, -CurrentUniverse.ReputationConfig.DropPenalty)
+
+	notifyShip(ship)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ship)
+}
+
+// ChatHistoryResponse is one page of a channel's history.
+type ChatHistoryResponse struct {
+	Channel    string         `json:"channel"`
+	Entries    []HistoryEntry `json:"entries"`
+	NextBefore int64          `json:"next_before"` // Pass as ?before= to fetch the previous page (0 = no more)
+}
+
+// handleGetChatHistory pages backwards through a channel's history.
+// Query: ?channel=chat_global&before=<seq>&limit=<n>
+func handleGetChatHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	channel := q.Get("channel")
+	if channel == "" {
+		channel = "chat_global"
+	}
+
+	before, _ := strconv.ParseInt(q.Get("before"), 10, 64)
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	entries := gameHub.history.Page(channel, before, limit)
+	resp := ChatHistoryResponse{Channel: channel, Entries: entries}
+	if len(entries) == limit {
+		resp.NextBefore = entries[0].Seq
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleGetPresence lists pilots. Query: ?location=<planet_key> to see who is in
+// port, ?all=1 to include offline pilots.
+func handleGetPresence(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	pilots := gameHub.presence.List(q.Get("location"), q.Get("all") != "1")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pilots)
+}
+
+// handleGetStockpiles returns current warehouse levels. Query: ?planet=<planet_key>
+func handleGetStockpiles(w http.ResponseWriter, r *http.Request) {
+	dataLock.RLock()
+	defer dataLock.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if key := r.URL.Query().Get("planet"); key != "" {
+		json.NewEncoder(w).Encode(map[string]map[string]int{key: Market.Stockpile[key]})
+		return
+	}
+	json.NewEncoder(w).Encode(Market.Stockpile)
+}
+
+// handleGetTelemetry returns economy samples for charting.
+// Query: ?from=<unix>&to=<unix>&planet=<planet_key>&commodity=<item_key>
+func handleGetTelemetry(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, _ := strconv.ParseInt(q.Get("from"), 10, 64)
+	to, _ := strconv.ParseInt(q.Get("to"), 10, 64)
+
+	samples := QueryTelemetry(from, to, q.Get("planet"), q.Get("commodity"))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(samples)
+}
+
+// handleGetEvents lists running galactic events. Query: ?planet=<planet_key>
+func handleGetEvents(w http.ResponseWriter, r *http.Request) {
+	dataLock.RLock()
+	defer dataLock.RUnlock()
+
+	planetKey := r.URL.Query().Get("planet")
+	events := []ActiveEvent{}
+	for _, e := range ActiveEvents {
+		if planetKey == "" || e.PlanetKey == planetKey {
+			events = append(events, e)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// handleGetNPCs lists the NPC traders and what they are hauling.
+func handleGetNPCs(w http.ResponseWriter, r *http.Request) {
+	dataLock.RLock()
+	defer dataLock.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NPCs)
+}
+
+// handleGetAuctions lists open auctions. Query: ?planet=<origin_key>
+func handleGetAuctions(w http.ResponseWriter, r *http.Request) {
+	dataLock.RLock()
+	defer dataLock.RUnlock()
+
+	planetKey := r.URL.Query().Get("planet")
+	auctions := []*Auction{}
+	for _, a := range Auctions {
+		if planetKey == "" || a.Contract.OriginKey == planetKey {
+			auctions = append(auctions, a)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(auctions)
+}
+
+// handleBid places a bid on an auctioned contract.
+func handleBid(w http.ResponseWriter, r *http.Request) {
+	var req BidRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	auction, err := PlaceBid(ship, req.AuctionID, req.Amount)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(auction)
+}
+
+// handlePostContract lists a player-funded contract on the origin's board.
+func handlePostContract(w http.ResponseWriter, r *http.Request) {
+	var req PostContractRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	job, err := PostContract(ship, req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	notifyShip(ship)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleCancelPosting withdraws an unaccepted player contract and refunds escrow.
+func handleCancelPosting(w http.ResponseWriter, r *http.Request) {
+	var req ContractRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	if _, err := CancelPosting(ship, req.ContractID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	notifyShip(ship)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ship)
+}
+
+// handleGetPostings lists the caller's posted contracts and who is carrying them.
+func handleGetPostings(w http.ResponseWriter, r *http.Request) {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PostingsBy(pilotID(r)))
+}
+
+// handleGetMissions lists missions starting at the pilot's location.
+func handleGetMissions(w http.ResponseWriter, r *http.Request) {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	missions := AvailableMissions[ship.LocationKey]
+	if missions == nil {
+		missions = []Mission{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(missions)
+}
+
+// handleAcceptMission starts a mission and loads its first leg.
+func handleAcceptMission(w http.ResponseWriter, r *http.Request) {
+	var req MissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	mission, err := AcceptMission(ship, req.MissionID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	gameHub.SendToPilot(ship.PilotID, "mission_updated", MissionProgress{Mission: mission, Event: "leg_loaded", Text: mission.Legs[0].Text})
+	notifyShip(ship)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ship)
+}
+
+// handleAbandonMission gives up a mission, dumping the leg aboard.
+func handleAbandonMission(w http.ResponseWriter, r *http.Request) {
+	var req MissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	dropped, err := AbandonMission(ship, req.MissionID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	for _, c := range dropped {
+		adjustStanding(ship.PilotID, c.Faction, -CurrentUniverse.ReputationConfig.DropPenalty)
+	}
+
+	notifyShip(ship)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ship)
+}
+
+// handleGetReputation lists every faction with the caller's standing and tier.
+func handleGetReputation(w http.ResponseWriter, r *http.Request) {
+	dataLock.RLock()
+	defer dataLock.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Standings(pilotID(r)))
+}
+
+func handleGetBank(w http.ResponseWriter, r *http.Request) {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GetBankStatus(ship))
+}
+
+func handleBorrow(w http.ResponseWriter, r *http.Request) {
+	var req BankRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	status, err := Borrow(ship, req.Amount)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	notifyShip(ship)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+func handleRepay(w http.ResponseWriter, r *http.Request) {
+	var req BankRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	status, err := Repay(ship, req.Amount)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	notifyShip(ship)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleTow rescues a stranded ship; the fee may go onto the pilot's loan.
+func handleTow(w http.ResponseWriter, r *http.Request) {
+	var req TowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	result, err := TowShip(ship, req.DestinationKey)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	announceArrival(ship, result.TravelResult)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleGetInsurance quotes a policy for the pilot's next jump.
+func handleGetInsurance(w http.ResponseWriter, r *http.Request) {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	policy, err := QuoteInsurance(ship)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+func handleBuyInsurance(w http.ResponseWriter, r *http.Request) {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	if _, err := BuyInsurance(ship); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	notifyShip(ship)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ship)
+}
+
+// handleGetRepair quotes repairs at the pilot's current planet.
+func handleGetRepair(w http.ResponseWriter, r *http.Request) {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(QuoteRepair(ship))
+}
+
+func handleRepair(w http.ResponseWriter, r *http.Request) {
+	var req RepairRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	if _, err := RepairShip(ship, req.Part); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	notifyShip(ship)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ship)
+}
+
+func handleGetCrew(w http.ResponseWriter, r *http.Request) {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	resp := CrewResponse{
+		ForHire: CrewForHire[ship.LocationKey],
+		Roster:  ship.Crew,
+		Roles:   CurrentUniverse.CrewConfig.Roles,
+	}
+	if resp.ForHire == nil {
+		resp.ForHire = []CrewMember{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func handleHireCrew(w http.ResponseWriter, r *http.Request) {
+	var req CrewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	if _, err := HireCrew(ship, req.CrewID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	notifyShip(ship)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ship)
+}
+
+func handleDismissCrew(w http.ResponseWriter, r *http.Request) {
+	var req CrewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	if _, err := DismissCrew(ship, req.CrewID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	notifyShip(ship)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ship)
+}
+
+func handleGetFleet(w http.ResponseWriter, r *http.Request) {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GetFleet(ship))
+}
+
+// handleGetShipClasses lists hulls for sale (empty away from the shipyard).
+func handleGetShipClasses(w http.ResponseWriter, r *http.Request) {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	if ship.LocationKey != CurrentUniverse.FleetConfig.Shipyard {
+		json.NewEncoder(w).Encode([]ShipClass{})
+		return
+	}
+	json.NewEncoder(w).Encode(CurrentUniverse.FleetConfig.Classes)
+}
+
+func handleBuyShip(w http.ResponseWriter, r *http.Request) {
+	var req BuyShipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	if _, err := BuyShip(ship, req.ClassKey); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	notifyShip(ship)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GetFleet(ship))
+}
+
+// handleSwitchShip moves the pilot (and their credits) to another of their ships.
+func handleSwitchShip(w http.ResponseWriter, r *http.Request) {
+	var req FleetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	flown, err := SwitchShip(ship, req.ShipID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	gameHub.MovePilot(flown.PilotID, flown.LocationKey)
+	notifyShip(ship)
+	notifyShip(flown)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flown)
+}
+
+func handleSetRoute(w http.ResponseWriter, r *http.Request) {
+	var req FleetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	routed, err := SetRoute(ship, req.ShipID, req.Stops)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	notifyShip(routed)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(routed)
+}
+
+// corpResponse is what corp endpoints return to a member. Caller holds dataLock.
+func corpResponse(pilotID string) CorpResponse {
+	corp := Corps[CorpOf[pilotID]]
+	resp := CorpResponse{Corp: corp, Roles: CurrentUniverse.CorpConfig.Roles}
+	if corp != nil {
+		resp.Role = corp.Members[pilotID]
+	}
+	return resp
+}
+
+// decodeCorp reads a CorpRequest body, writing the error if it fails.
+func decodeCorp(w http.ResponseWriter, r *http.Request) (CorpRequest, bool) {
+	var req CorpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+func handleGetCorp(w http.ResponseWriter, r *http.Request) {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(corpResponse(ship.PilotID))
+}
+
+func handleListCorps(w http.ResponseWriter, r *http.Request) {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListCorps())
+}
+
+func handleCreateCorp(w http.ResponseWriter, r *http.Request) {
+	var req CreateCorpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	if _, err := CreateCorp(ship, req); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	notifyShip(ship)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(corpResponse(ship.PilotID))
+}
+
+func handleJoinCorp(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeCorp(w, r)
+	if !ok {
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	if _, err := JoinCorp(ship, req.CorpID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(corpResponse(ship.PilotID))
+}
+
+func handleLeaveCorp(w http.ResponseWriter, r *http.Request) {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	if err := LeaveCorp(ship); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	notifyShip(ship)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ship)
+}
+
+func handleInviteToCorp(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeCorp(w, r)
+	if !ok {
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	corp, err := InviteToCorp(ship, req.PilotID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	gameHub.SendToPilot(req.PilotID, "corp_invite", CorpSummary{ID: corp.ID, Name: corp.Name, Tag: corp.Tag})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(corpResponse(ship.PilotID))
+}
+
+// handleSetCorpRole changes a member's role; handleKickFromCorp is the same
+// with no role.
+func handleSetCorpRole(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeCorp(w, r)
+	if !ok {
+		return
+	}
+	if req.Role == "" {
+		http.Error(w, "Role required", http.StatusBadRequest)
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	if _, err := SetCorpRole(ship, req.PilotID, req.Role); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(corpResponse(ship.PilotID))
+}
+
+func handleKickFromCorp(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeCorp(w, r)
+	if !ok {
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	if req.PilotID == ship.PilotID {
+		http.Error(w, "Use /api/corp/leave to leave", http.StatusBadRequest)
+		return
+	}
+	corp, err := SetCorpRole(ship, req.PilotID, "")
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	gameHub.SendToPilot(req.PilotID, "corp_kicked", CorpSummary{ID: corp.ID, Name: corp.Name, Tag: corp.Tag})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(corpResponse(ship.PilotID))
+}
+
+func handleCorpDeposit(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeCorp(w, r)
+	if !ok {
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	if _, err := DepositToCorp(ship, req.Amount); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	notifyShip(ship)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(corpResponse(ship.PilotID))
+}
+
+func handleCorpWithdraw(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeCorp(w, r)
+	if !ok {
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	if _, err := WithdrawFromCorp(ship, req.Amount); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	notifyShip(ship)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(corpResponse(ship.PilotID))
+}
+
+func handleGetCorpLedger(w http.ResponseWriter, r *http.Request) {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	corp, err := myCorp(ship.PilotID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(corp.Ledger)
+}
+
+func handleGetCorpContracts(w http.ResponseWriter, r *http.Request) {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	corp, err := myCorp(ship.PilotID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CorpContracts(corp))
+}
+
+func handlePostCorpContract(w http.ResponseWriter, r *http.Request) {
+	var req PostContractRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	job, err := PostCorpContract(ship, req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+func handleAcceptCorpContract(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeCorp(w, r)
+	if !ok {
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	if _, err := AcceptCorpContract(ship, req.ContractID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	notifyShip(ship)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ship)
+}
+
+func handleCancelCorpContract(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeCorp(w, r)
+	if !ok {
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	job, err := CancelCorpContract(ship, req.ContractID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleCorpChat returns the corp channel's history (GET) or posts to it (POST).
+func handleCorpChat(w http.ResponseWriter, r *http.Request) {
+	var req CorpRequest
+	if r.Method == http.MethodPost {
+		var ok bool
+		if req, ok = decodeCorp(w, r); !ok {
+			return
+		}
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	corp, err := myCorp(ship.PilotID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if r.Method == http.MethodPost {
+		if _, err := PostCorpChat(ship, req.Text); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(corp.Chat)
+}
+
+// handleGetLedger pages through the pilot's credit ledger, newest last.
+// Query: ?before=<seq>&limit=<n>
+func handleGetLedger(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	before, _ := strconv.ParseInt(q.Get("before"), 10, 64)
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LedgerFor(ship.PilotID, before, limit))
+}
+
+func handleTransfer(w http.ResponseWriter, r *http.Request) {
+	var req TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	ship := GetPilotShip(pilotID(r))
+
+	entry, err := TransferCredits(ship, req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	notifyShip(ship)
+	notifyShip(Pilots[req.ToPilot])
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(PlayerShip)
+	json.NewEncoder(w).Encode(entry)
 }
@@ -0,0 +1,148 @@
+/*
+Package main
+File: handling.go
+Description: Special-handling cargo. Commodities carry flags from universe.yaml
+(hazardous, fragile, perishable, refrigerated, illegal). Hazardous and refrigerated
+goods need a containment vault or cold storage aboard before they can be accepted,
+and hazardous, fragile and perishable cargo lose value in transit.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+)
+
+// Commodity handling flags
+const (
+	FlagHazardous    = "hazardous"
+	FlagFragile      = "fragile"
+	FlagPerishable   = "perishable"
+	FlagRefrigerated = "refrigerated"
+	FlagIllegal      = "illegal"
+)
+
+// HandlingConfig tunes the transit mechanics from YAML.
+type HandlingConfig struct {
+	HazardousPremium     float64 `yaml:"hazardous_premium" json:"hazardous_premium"`             // Payout multiplier
+	FragilePremium       float64 `yaml:"fragile_premium" json:"fragile_premium"`                 // Payout multiplier
+	PerishablePremium    float64 `yaml:"perishable_premium" json:"perishable_premium"`           // Payout multiplier
+	IncidentChancePerLY  float64 `yaml:"incident_chance_per_ly" json:"incident_chance_per_ly"`   // Hazardous: containment incident odds per LY
+	IncidentLoss         int     `yaml:"incident_loss" json:"incident_loss"`                     // Hazardous: % of payout lost per incident
+	FragileDamage        int     `yaml:"fragile_damage" json:"fragile_damage"`                   // Fragile: % lost per jump at lane_hazard 1.0
+	PerishableDecayPerLY int     `yaml:"perishable_decay_per_ly" json:"perishable_decay_per_ly"` // Perishable: % lost per LY (halved with cold storage)
+}
+
+// CargoIncident is value lost by one contract on one jump.
+type CargoIncident struct {
+	ContractID string `json:"contract_id"`
+	Kind       string `json:"kind"` // The flag responsible
+	Loss       int    `json:"loss"` // Credits knocked off the payout
+	Text       string `json:"text"`
+}
+
+// HasFlag reports whether a commodity has a handling flag.
+func (c *Commodity) HasFlag(flag string) bool {
+	for _, f := range c.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// HasFlag reports whether a contract's goods have a handling flag.
+func (c Contract) HasFlag(flag string) bool {
+	for _, f := range c.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// setCommodity fills a contract's goods from a commodity, flags included.
+// Set DestinationKey first so smuggling jobs are marked as contraband.
+func (c *Contract) setCommodity(comm *Commodity) {
+	c.ItemName = comm.Name
+	c.ItemKey = comm.Key
+	c.MassPerUnit = comm.Mass
+	c.Flags = append([]string(nil), comm.Flags...)
+	c.Contraband = isBanned(GetPlanet(c.DestinationKey), comm.Key)
+}
+
+// handlingPremium is the payout multiplier for a commodity's flags.
+func handlingPremium(comm *Commodity) float64 {
+	cfg := CurrentUniverse.HandlingConfig
+	mult := 1.0
+	if comm.HasFlag(FlagHazardous) && cfg.HazardousPremium > 0 {
+		mult *= cfg.HazardousPremium
+	}
+	if comm.HasFlag(FlagFragile) && cfg.FragilePremium > 0 {
+		mult *= cfg.FragilePremium
+	}
+	if comm.HasFlag(FlagPerishable) && cfg.PerishablePremium > 0 {
+		mult *= cfg.PerishablePremium
+	}
+	return mult
+}
+
+// canHandle checks the ship has the equipment a contract's goods need.
+func canHandle(ship *Ship, c Contract) error {
+	if c.HasFlag(FlagHazardous) && ship.Containment <= 0 {
+		return serviceError(http.StatusConflict, "Hazardous cargo requires a containment vault")
+	}
+	if c.HasFlag(FlagRefrigerated) && ship.Refrigeration <= 0 {
+		return serviceError(http.StatusConflict, "Refrigerated cargo requires cold storage")
+	}
+	return nil
+}
+
+// laneHazard is the roughness of the lane between two planets (the worse end).
+func laneHazard(a, b *Planet) float64 {
+	if a.LaneHazard > b.LaneHazard {
+		return a.LaneHazard
+	}
+	return b.LaneHazard
+}
+
+// applyHandling docks value from a contract for one jump of dist LY on a lane
+// of the given hazard, rolling on the voyage's RNG. Returns what happened, if anything.
+func applyHandling(ship *Ship, c *Contract, dist int64, hazard float64, rng *rand.Rand) []CargoIncident {
+	cfg := CurrentUniverse.HandlingConfig
+	incidents := []CargoIncident{}
+	lose := func(kind string, pct float64, text string) {
+		loss := int(float64(c.Payout) * pct / 100 * crewReduction(ship, RoleEngineer))
+		if loss <= 0 {
+			return
+		}
+		c.Payout -= loss
+		incidents = append(incidents, CargoIncident{ContractID: c.ID, Kind: kind, Loss: loss, Text: text})
+	}
+
+	if c.HasFlag(FlagHazardous) {
+		odds := cfg.IncidentChancePerLY * float64(dist)
+		if ship.Containment > 1 {
+			odds /= float64(ship.Containment) // Extra vaults make incidents rarer
+		}
+		if rng.Float64() < odds {
+			lose(FlagHazardous, float64(cfg.IncidentLoss), fmt.Sprintf("Containment breach! Part of the %s had to be vented.", c.ItemName))
+		}
+	}
+	if c.HasFlag(FlagFragile) && hazard > 0 {
+		lose(FlagFragile, float64(cfg.FragileDamage)*hazard, fmt.Sprintf("Rough lane. Some of the %s arrived broken.", c.ItemName))
+	}
+	if c.HasFlag(FlagPerishable) {
+		decay := float64(cfg.PerishableDecayPerLY) * float64(dist)
+		if ship.Refrigeration > 0 {
+			decay /= 2
+		}
+		if decay > 100 {
+			decay = 100
+		}
+		lose(FlagPerishable, decay, fmt.Sprintf("The %s is spoiling.", c.ItemName))
+	}
+	return incidents
+}
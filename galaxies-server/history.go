@@ -0,0 +1,255 @@
+/*
+Package main
+File: history.go
+Description: Keeps a bounded backlog of chat and system events per channel so that
+clients joining (or re-joining after a crash) can catch up on the conversation.
+The backlog can optionally be persisted to a JSON-lines file and reloaded on boot.
+The file is rewritten to just the ring contents on boot and whenever it grows to
+twice that, so it stays as bounded as the rings.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	historyCapacity  = 500 // Entries kept in memory per channel
+	backlogOnConnect = 50  // Entries per channel replayed to a new connection
+)
+
+// HistoryEntry is a single recorded message with its server-side sequence number.
+type HistoryEntry struct {
+	Seq       int64           `json:"seq"`
+	Channel   string          `json:"channel"`
+	Timestamp int64           `json:"timestamp"` // Unix seconds
+	Message   json.RawMessage `json:"message"`
+}
+
+// historyRing is a fixed-size ring buffer of entries, oldest first.
+type historyRing struct {
+	entries []HistoryEntry
+	start   int
+	size    int
+}
+
+func newHistoryRing(capacity int) *historyRing {
+	return &historyRing{entries: make([]HistoryEntry, capacity)}
+}
+
+func (r *historyRing) push(e HistoryEntry) {
+	if r.size < len(r.entries) {
+		r.entries[(r.start+r.size)%len(r.entries)] = e
+		r.size++
+		return
+	}
+	// Full: overwrite the oldest entry
+	r.entries[r.start] = e
+	r.start = (r.start + 1) % len(r.entries)
+}
+
+// slice returns the entries in chronological order.
+func (r *historyRing) slice() []HistoryEntry {
+	out := make([]HistoryEntry, r.size)
+	for i := 0; i < r.size; i++ {
+		out[i] = r.entries[(r.start+i)%len(r.entries)]
+	}
+	return out
+}
+
+// ChatHistory stores recent chat/system events for every channel.
+type ChatHistory struct {
+	mu       sync.RWMutex
+	nextSeq  int64
+	channels map[string]*historyRing
+	logPath  string
+	logFile  *os.File // nil when persistence is disabled
+	logLines int      // Entries in logFile, kept and dropped
+}
+
+// NewChatHistory creates the history store. If path is non-empty, previous entries
+// are reloaded from that file and new entries are appended to it.
+func NewChatHistory(path string) (*ChatHistory, error) {
+	h := &ChatHistory{
+		nextSeq:  1,
+		channels: make(map[string]*historyRing),
+	}
+	if path == "" {
+		return h, nil
+	}
+
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var e HistoryEntry
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				continue // Skip corrupt lines rather than refusing to boot
+			}
+			h.ring(e.Channel).push(e)
+			if e.Seq >= h.nextSeq {
+				h.nextSeq = e.Seq + 1
+			}
+		}
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	h.logPath = path
+	if err := h.compact(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// compact rewrites the log to the entries still in the rings and reopens it
+// for appending. Caller holds mu (or is NewChatHistory).
+func (h *ChatHistory) compact() error {
+	kept := []HistoryEntry{}
+	for _, r := range h.channels {
+		kept = append(kept, r.slice()...)
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Seq < kept[j].Seq })
+
+	tmp := h.logPath + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, e := range kept {
+		if line, err := json.Marshal(e); err == nil {
+			w.Write(append(line, '\n'))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+	if err := os.Rename(tmp, h.logPath); err != nil {
+		return err
+	}
+
+	if h.logFile != nil {
+		h.logFile.Close()
+	}
+	h.logFile, err = os.OpenFile(h.logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		h.logFile = nil
+		return err
+	}
+	h.logLines = len(kept)
+	return nil
+}
+
+// ring returns the buffer for a channel, creating it if needed. Caller holds mu.
+func (h *ChatHistory) ring(channel string) *historyRing {
+	r, ok := h.channels[channel]
+	if !ok {
+		r = newHistoryRing(historyCapacity)
+		h.channels[channel] = r
+	}
+	return r
+}
+
+// historyChannel decides whether a hub message is worth keeping, and under which channel.
+// Chat is kept per chat type; alerts are grouped under "system". Everything else
+// (market pulses etc.) is transient state and is not recorded.
+func historyChannel(msgType string) (string, bool) {
+	switch {
+	case strings.HasPrefix(msgType, "chat_"):
+		return msgType, true
+	case strings.HasPrefix(msgType, "system"):
+		return "system", true
+	}
+	return "", false
+}
+
+// Record stores a raw hub message if it belongs to a history channel.
+func (h *ChatHistory) Record(raw []byte) {
+	var msg Message
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return
+	}
+	channel, ok := historyChannel(msg.Type)
+	if !ok {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e := HistoryEntry{
+		Seq:       h.nextSeq,
+		Channel:   channel,
+		Timestamp: time.Now().Unix(),
+		Message:   json.RawMessage(append([]byte(nil), raw...)),
+	}
+	h.nextSeq++
+	h.ring(channel).push(e)
+
+	if h.logFile != nil {
+		if line, err := json.Marshal(e); err == nil {
+			h.logFile.Write(append(line, '\n'))
+			h.logLines++
+		}
+		if h.logLines >= 2*historyCapacity*len(h.channels) {
+			if err := h.compact(); err != nil {
+				log.Printf("History: compacting %s failed: %v", h.logPath, err)
+			}
+		}
+	}
+}
+
+// Backlog returns the most recent entries of every channel, in sequence order.
+func (h *ChatHistory) Backlog(perChannel int) []HistoryEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	out := []HistoryEntry{}
+	for _, r := range h.channels {
+		entries := r.slice()
+		if len(entries) > perChannel {
+			entries = entries[len(entries)-perChannel:]
+		}
+		out = append(out, entries...)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Seq < out[j].Seq })
+	return out
+}
+
+// Page returns up to 'limit' entries of a channel older than 'before' (0 = newest),
+// in chronological order.
+func (h *ChatHistory) Page(channel string, before int64, limit int) []HistoryEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	r, ok := h.channels[channel]
+	if !ok {
+		return []HistoryEntry{}
+	}
+	entries := r.slice()
+
+	end := len(entries)
+	if before > 0 {
+		end = 0
+		for end < len(entries) && entries[end].Seq < before {
+			end++
+		}
+	}
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+	return append([]HistoryEntry{}, entries[start:end]...)
+}
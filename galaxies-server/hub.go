@@ -7,6 +7,7 @@ Description: Manages WebSocket connections and message broadcasting.
 package main
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
 
@@ -25,23 +26,73 @@ type Client struct {
 	hub  *Hub
 	conn *websocket.Conn
 	send chan []byte // Buffered channel of outbound messages
+
+	// pilotID ties the connection to a ship for targeted events (from ?token= on connect)
+	pilotID string
+
+	// Planets whose board diffs this client wants in market pulses. Owned by Hub.Run.
+	subscriptions map[string]bool
+}
+
+// subscription is a client's request to replace its set of watched planets.
+type subscription struct {
+	client     *Client
+	planetKeys []string
 }
 
-// Hub maintains the set of active clients and broadcasts messages
+// hubEnvelope is what travels through the Broker. Every instance receives every
+// envelope and delivers it to whichever of its own clients it concerns.
+type hubEnvelope struct {
+	Kind    string          `json:"kind"`               // "broadcast", "direct" or "pulse"
+	PilotID string          `json:"pilot_id,omitempty"` // Target of a "direct" envelope
+	Data    json.RawMessage `json:"data,omitempty"`     // Pre-marshaled Message
+	Diffs   []PlanetDiff    `json:"diffs,omitempty"`    // Market diffs, filtered per client subscription
+}
+
+// Hub maintains the set of active clients and broadcasts messages.
+// Outbound traffic is published to the Broker; Run only delivers what comes back,
+// so the same path works for one process or many.
 type Hub struct {
 	clients    map[*Client]bool
-	broadcast  chan []byte
 	register   chan *Client
 	unregister chan *Client
+	subscribe  chan subscription
+	inbound    chan hubEnvelope
+	outbox     chan []byte // Marshaled envelopes waiting for the broker
+	broker     Broker
+	history    *ChatHistory // Recent chat/system events replayed to new clients
+	presence   *PresenceTracker
 }
 
-func NewHub() *Hub {
-	return &Hub{
-		broadcast:  make(chan []byte),
+func NewHub(history *ChatHistory, broker Broker) (*Hub, error) {
+	h := &Hub{
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		clients:    make(map[*Client]bool),
+		subscribe:  make(chan subscription),
+		inbound:    make(chan hubEnvelope, 256),
+		outbox:     make(chan []byte, outboxSize),
+		broker:     broker,
+		history:    history,
+		presence:   NewPresenceTracker(),
 	}
+
+	msgs, err := broker.Subscribe(hubTopic)
+	if err != nil {
+		return nil, err
+	}
+	go h.drainOutbox()
+	go func() {
+		for raw := range msgs {
+			var env hubEnvelope
+			if err := json.Unmarshal(raw, &env); err != nil {
+				log.Printf("Broker: bad envelope: %v", err)
+				continue
+			}
+			h.inbound <- env
+		}
+	}()
+	return h, nil
 }
 
 func (h *Hub) Run() {
@@ -50,48 +101,267 @@ func (h *Hub) Run() {
 		case client := <-h.register:
 			h.clients[client] = true
 			log.Println("WS: New Connection Registered")
+			// Sent here, where broadcasts are recorded, so nothing falls between
+			// the backlog and live traffic
+			h.sendBacklog(client)
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
 				close(client.send)
 			}
-		case message := <-h.broadcast:
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+		case sub := <-h.subscribe:
+			if _, ok := h.clients[sub.client]; ok {
+				sub.client.subscriptions = make(map[string]bool)
+				for _, key := range sub.planetKeys {
+					sub.client.subscriptions[key] = true
 				}
 			}
+		case env := <-h.inbound:
+			switch env.Kind {
+			case "broadcast":
+				h.history.Record(env.Data)
+				h.applyPresence(env.Data)
+				for client := range h.clients {
+					h.deliver(client, env.Data)
+				}
+			case "direct":
+				for client := range h.clients {
+					if client.pilotID == env.PilotID {
+						h.deliver(client, env.Data)
+					}
+				}
+			case "pulse":
+				h.sendPulse(env.Diffs)
+			}
 		}
 	}
 }
 
+// sendBacklog queues the recent history for a newly registered client.
+// Only called from Run.
+func (h *Hub) sendBacklog(client *Client) {
+	backlog, err := json.Marshal(Message{
+		Type:    "history_backlog",
+		Payload: h.history.Backlog(backlogOnConnect),
+		Sender:  "SERVER",
+	})
+	if err != nil {
+		log.Printf("Error marshaling backlog: %v", err)
+		return
+	}
+	h.deliver(client, backlog)
+}
+
+// deliver queues a message for a client, dropping the client if it can't keep up.
+// Only called from Run.
+func (h *Hub) deliver(client *Client, data []byte) {
+	select {
+	case client.send <- data:
+	default:
+		close(client.send)
+		delete(h.clients, client)
+	}
+}
+
+// publish queues an envelope for the broker without waiting on it, so callers
+// holding dataLock never stall on a slow broker or a busy hub. If the queue is
+// full the envelope is dropped. Never called from Run.
+func (h *Hub) publish(env hubEnvelope) {
+	data, err := json.Marshal(env)
+	if err != nil {
+		log.Printf("Error marshaling %s envelope: %v", env.Kind, err)
+		return
+	}
+	select {
+	case h.outbox <- data:
+	default:
+		log.Printf("Broker: outbox full, dropped %s envelope", env.Kind)
+	}
+}
+
+// drainOutbox is the only goroutine that publishes, so envelopes keep their
+// order. A broker that loops back (MemoryBroker) blocks here, not in publish.
+func (h *Hub) drainOutbox() {
+	for data := range h.outbox {
+		if err := h.broker.Publish(hubTopic, data); err != nil {
+			log.Printf("Broker: publish failed: %v", err)
+		}
+	}
+}
+
+// Broadcast sends a raw message to every client on every instance.
+func (h *Hub) Broadcast(message []byte) {
+	h.publish(hubEnvelope{Kind: "broadcast", Data: message})
+}
+
+// SendPulse sends market diffs; each instance filters them per subscription.
+func (h *Hub) SendPulse(diffs []PlanetDiff) {
+	h.publish(hubEnvelope{Kind: "pulse", Diffs: diffs})
+}
+
+// SendToPilot delivers an event to all of a pilot's open connections.
+// The payload is marshaled immediately, so callers may hold dataLock.
+func (h *Hub) SendToPilot(pilotID, msgType string, payload interface{}) {
+	data, err := json.Marshal(Message{Type: msgType, Payload: payload, Sender: "SERVER"})
+	if err != nil {
+		log.Printf("Error marshaling %s: %v", msgType, err)
+		return
+	}
+	h.publish(hubEnvelope{Kind: "direct", PilotID: pilotID, Data: data})
+}
+
+// publishPresence broadcasts a pilot's presence change to everyone.
+func (h *Hub) publishPresence(p Presence) {
+	data, err := json.Marshal(Message{Type: "presence_updated", Payload: p, Sender: "SERVER"})
+	if err != nil {
+		log.Printf("Error marshaling presence: %v", err)
+		return
+	}
+	h.Broadcast(data)
+}
+
+// applyPresence folds presence events from other instances into our tracker,
+// so /api/presence lists pilots connected anywhere.
+func (h *Hub) applyPresence(data []byte) {
+	var msg struct {
+		Type    string   `json:"type"`
+		Payload Presence `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Type != "presence_updated" {
+		return
+	}
+	h.presence.Apply(msg.Payload)
+}
+
+// MovePilot records a docked pilot's new location and announces it.
+func (h *Hub) MovePilot(pilotID, locationKey string) {
+	if p, ok := h.presence.Move(pilotID, locationKey); ok {
+		h.publishPresence(p)
+	}
+}
+
+// JumpPilot shows a pilot in transit between two planets and announces it.
+func (h *Hub) JumpPilot(pilotID, fromKey, destKey string, distance int64) {
+	if p, ok := h.presence.Depart(pilotID, fromKey, destKey, distance); ok {
+		h.publishPresence(p)
+	}
+}
+
+// sendPulse delivers a market_pulse to every client. All clients learn which
+// planets changed; only subscribers of a planet receive its full diff.
+func (h *Hub) sendPulse(diffs []PlanetDiff) {
+	keys := make([]string, 0, len(diffs))
+	for _, d := range diffs {
+		keys = append(keys, d.PlanetKey)
+	}
+
+	for client := range h.clients {
+		mine := []PlanetDiff{}
+		for _, d := range diffs {
+			if client.subscriptions[d.PlanetKey] {
+				mine = append(mine, d)
+			}
+		}
+		msg, err := json.Marshal(map[string]interface{}{
+			"type":            "market_pulse",
+			"updated_planets": keys,
+			"diffs":           mine,
+		})
+		if err != nil {
+			log.Printf("Error marshaling pulse: %v", err)
+			return
+		}
+		h.deliver(client, msg)
+	}
+}
+
+// clientChatChannels are the message types clients may send over the socket.
+var clientChatChannels = map[string]bool{"chat_global": true, "chat_local": true}
+
+// outboxSize is how many envelopes may wait for the broker before publish drops.
+const outboxSize = 1024
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
 	CheckOrigin:     func(r *http.Request) bool { return true },
 }
 
-// serveWs handles websocket requests from the peer.
+// serveWs handles websocket requests from the peer. The connection must carry
+// a session token (?token=), which decides whose events it receives.
 func serveWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	// Read the pilot's ship for presence (the hub itself never takes dataLock)
+	ship, ok := lookupShip(sessionToken(r))
+	if !ok {
+		http.Error(w, "Session required", http.StatusUnauthorized)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("WS Upgrade Error:", err)
 		return
 	}
-	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256)}
+	client := &Client{
+		hub:           hub,
+		conn:          conn,
+		send:          make(chan []byte, 256),
+		subscriptions: make(map[string]bool),
+		pilotID:       ship.PilotID,
+	}
+	shipName, locationKey := ship.Name, ship.LocationKey
+
+	// Run queues the backlog as it registers the client
 	client.hub.register <- client
+	if p, cameOnline := hub.presence.Connect(client.pilotID, shipName, locationKey); cameOnline {
+		hub.publishPresence(p)
+	}
 
 	go client.writePump()
 	go client.readPump()
 }
 
+// lookupShip returns the ship of the pilot a session token belongs to. Replicas
+// ask the primary, which owns the sessions and the game state.
+func lookupShip(token string) (Ship, bool) {
+	if primaryURL == "" {
+		sess, ok := sessions.Lookup(token)
+		if !ok {
+			return Ship{}, false
+		}
+		dataLock.Lock()
+		defer dataLock.Unlock()
+		return *GetPilotShip(sess.PilotID), true
+	}
+
+	req, err := http.NewRequest(http.MethodGet, primaryURL+"/api/ship", nil)
+	if err != nil {
+		return Ship{}, false
+	}
+	req.Header.Set("X-Session-Token", token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("WS: ship lookup on primary failed: %v", err)
+		return Ship{}, false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Ship{}, false
+	}
+	var ship Ship
+	if err := json.NewDecoder(resp.Body).Decode(&ship); err != nil {
+		return Ship{}, false
+	}
+	return ship, true
+}
+
 func (c *Client) readPump() {
 	defer func() {
 		c.hub.unregister <- c
 		c.conn.Close()
+		if p, wentOffline := c.hub.presence.Disconnect(c.pilotID); wentOffline {
+			c.hub.publishPresence(p)
+		}
 	}()
 	for {
 		_, message, err := c.conn.ReadMessage()
@@ -102,8 +372,39 @@ func (c *Client) readPump() {
 		// Log this so you can see it in your VPS terminal!
 		log.Printf("Received Message: %s", string(message))
 
-		// Broadcast exactly what was received to everyone
-		c.hub.broadcast <- message
+		// Control messages are handled by the hub, not relayed
+		var msg Message
+		parsed := json.Unmarshal(message, &msg) == nil
+		if parsed && msg.Type == "subscribe_planets" {
+			keys := []string{}
+			if list, ok := msg.Payload.([]interface{}); ok {
+				for _, k := range list {
+					if key, ok := k.(string); ok {
+						keys = append(keys, key)
+					}
+				}
+			}
+			c.hub.subscribe <- subscription{client: c, planetKeys: keys}
+			continue
+		}
+
+		// Clients may only chat on the public channels. System alerts, presence and
+		// the rest come from the server, so anything else (or anything unparsable)
+		// is dropped rather than relayed into everyone's history. Corp chat is
+		// members-only and goes through /api/corp/chat.
+		text, isText := msg.Payload.(string)
+		if !parsed || !clientChatChannels[msg.Type] || !isText {
+			log.Printf("WS: dropped client message of type %q", msg.Type)
+			continue
+		}
+
+		// Relay it under the authenticated pilot, whatever sender the client claimed
+		relay, err := json.Marshal(Message{Type: msg.Type, Payload: text, Sender: c.pilotID})
+		if err != nil {
+			log.Printf("Error marshaling chat: %v", err)
+			continue
+		}
+		c.hub.Broadcast(relay)
 	}
 }
 
@@ -124,4 +425,3 @@ func (c *Client) writePump() {
 	// Send close message if channel was closed
 	c.conn.WriteMessage(websocket.CloseMessage, []byte{})
 }
-
@@ -0,0 +1,221 @@
+/*
+Package main
+File: ledger.go
+Description: The credit ledger. Every change to a pilot's credits goes through
+moveCredits, which appends an entry recording why, how much, the balance after
+and the contract, module or mission involved. Entries are never edited; a
+payout reversed later gets its own entry. Pilots can also send each other
+credits, with an entry on both sides sharing a transfer ID.
+/api/ledger is a rolling window: only the last size entries per pilot stay in
+memory, so an old transfer may show on one side and not the other. With
+GALAXIES_LEDGER_ARCHIVE set, entries leaving the window are appended to that
+file for audits and disputes. The archive is never replayed, because wallets
+themselves don't survive a restart.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// LedgerConfig tunes pilot-to-pilot transfers from YAML.
+type LedgerConfig struct {
+	Size               int   `yaml:"size" json:"size"`                                   // Entries kept per pilot
+	TransferMinVoyages int   `yaml:"transfer_min_voyages" json:"transfer_min_voyages"`   // Jumps the sender's fleet must have flown
+	TransferMinAge     int64 `yaml:"transfer_min_age" json:"transfer_min_age"`           // Seconds since the sender's session opened
+	SameOriginTransfer bool  `yaml:"same_origin_transfers" json:"same_origin_transfers"` // Allow transfers between sessions opened from one host
+}
+
+// LedgerEntry is one credit movement in a pilot's wallet.
+type LedgerEntry struct {
+	Seq          int64  `json:"seq"`
+	Time         int64  `json:"time"` // Unix seconds
+	PilotID      string `json:"pilot_id"`
+	ShipID       string `json:"ship_id,omitempty"` // Ship the wallet was aboard
+	Reason       string `json:"reason"`            // e.g. "delivery", "refuel", "module_purchase", "transfer_out"
+	Amount       int    `json:"amount"`            // Positive in, negative out
+	Balance      int    `json:"balance"`           // Credits after this entry
+	ContractID   string `json:"contract_id,omitempty"`
+	ModuleKey    string `json:"module_key,omitempty"`
+	MissionID    string `json:"mission_id,omitempty"`
+	Counterparty string `json:"counterparty,omitempty"` // Other pilot or corp
+	TransferID   string `json:"transfer_id,omitempty"`
+	Note         string `json:"note,omitempty"`
+}
+
+// LedgerPage is the response of /api/ledger.
+type LedgerPage struct {
+	Entries    []LedgerEntry `json:"entries"`
+	NextBefore int64         `json:"next_before,omitempty"` // Pass as ?before= for older entries
+}
+
+// TransferRequest sends credits to another pilot.
+type TransferRequest struct {
+	ToPilot string `json:"to_pilot"`
+	Amount  int    `json:"amount"`
+	Note    string `json:"note"`
+}
+
+// Ledgers maps PilotID -> entries, oldest first. Guarded by dataLock.
+var (
+	Ledgers       = make(map[string][]LedgerEntry)
+	ledgerSeq     int64
+	ledgerArchive *os.File // nil when archiving is disabled
+)
+
+// OpenLedgerArchive appends entries evicted from the window to path, if set.
+func OpenLedgerArchive(path string) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	ledgerArchive = f
+	return nil
+}
+
+// moveCredits changes a player's credits and records why. NPC wallets aren't
+// ledgered. Caller holds dataLock.
+func moveCredits(ship *Ship, amount int, e LedgerEntry) LedgerEntry {
+	ship.Credits += amount
+	return recordCredits(ship, amount, e)
+}
+
+// recordCredits appends an entry for credits that have already moved.
+// Caller holds dataLock.
+func recordCredits(ship *Ship, amount int, e LedgerEntry) LedgerEntry {
+	if _, player := Pilots[ship.PilotID]; !player || amount == 0 {
+		return e
+	}
+	ledgerSeq++
+	e.Seq = ledgerSeq
+	e.Time = time.Now().Unix()
+	e.PilotID = ship.PilotID
+	e.ShipID = ship.ShipID
+	e.Amount = amount
+	e.Balance = ship.Credits
+	entries := append(Ledgers[ship.PilotID], e)
+	if max := CurrentUniverse.LedgerConfig.Size; max > 0 && len(entries) > max {
+		archiveEntries(entries[:len(entries)-max])
+		entries = entries[len(entries)-max:]
+	}
+	Ledgers[ship.PilotID] = entries
+	return e
+}
+
+// archiveEntries writes entries leaving the window to the archive, if any.
+func archiveEntries(entries []LedgerEntry) {
+	if ledgerArchive == nil {
+		return
+	}
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			continue
+		}
+		if _, err := ledgerArchive.Write(append(line, '\n')); err != nil {
+			log.Printf("Ledger: archive write failed: %v", err)
+			return
+		}
+	}
+}
+
+// LedgerFor returns up to limit of a pilot's entries older than before (0 =
+// newest), in chronological order. Caller holds dataLock.
+func LedgerFor(pilotID string, before int64, limit int) LedgerPage {
+	entries := Ledgers[pilotID]
+	end := len(entries)
+	if before > 0 {
+		end = 0
+		for end < len(entries) && entries[end].Seq < before {
+			end++
+		}
+	}
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+
+	page := LedgerPage{Entries: append([]LedgerEntry{}, entries[start:end]...)}
+	if start > 0 {
+		page.NextBefore = entries[start].Seq
+	}
+	return page
+}
+
+// TransferCredits sends credits from the pilot to another pilot, subject to
+// checkSender and to the two not sharing a host. Caller holds dataLock.
+func TransferCredits(ship *Ship, req TransferRequest) (LedgerEntry, error) {
+	if req.Amount <= 0 {
+		return LedgerEntry{}, serviceError(http.StatusBadRequest, "Amount must be positive")
+	}
+	if req.ToPilot == ship.PilotID {
+		return LedgerEntry{}, serviceError(http.StatusBadRequest, "Cannot transfer to yourself")
+	}
+	to, ok := Pilots[req.ToPilot]
+	if !ok {
+		return LedgerEntry{}, serviceError(http.StatusNotFound, "Pilot not found")
+	}
+	if err := checkSender(ship.PilotID); err != nil {
+		return LedgerEntry{}, err
+	}
+	if sameOrigin(ship.PilotID, to.PilotID) {
+		return LedgerEntry{}, serviceError(http.StatusForbidden, "Cannot send credits between accounts on the same connection")
+	}
+	if ship.Credits < req.Amount {
+		return LedgerEntry{}, serviceError(http.StatusPaymentRequired, "Insufficient credits")
+	}
+
+	id := fmt.Sprintf("TRF-%d", ledgerSeq+1)
+	sent := moveCredits(ship, -req.Amount, LedgerEntry{Reason: "transfer_out", Counterparty: to.PilotID, TransferID: id, Note: req.Note})
+	received := moveCredits(to, req.Amount, LedgerEntry{Reason: "transfer_in", Counterparty: ship.PilotID, TransferID: id, Note: req.Note})
+	gameHub.SendToPilot(to.PilotID, "credits_received", received)
+	return sent, nil
+}
+
+// checkSender gates every way a pilot can hand credits to someone else:
+// transfers, contract escrow and the corp treasury. Pilots in debt can't move
+// money out of the bank's reach, and accounts too new or with too few jumps
+// can't send at all, so fresh sessions can't be farmed for starting credits.
+// Caller holds dataLock.
+func checkSender(pilotID string) error {
+	cfg := CurrentUniverse.LedgerConfig
+	if debt(pilotID) > 0 {
+		return serviceError(http.StatusForbidden, "Repay your loan before sending credits")
+	}
+	sess, ok := sessions.ForPilot(pilotID)
+	if !ok {
+		return serviceError(http.StatusForbidden, "Session required")
+	}
+	if age := time.Now().Unix() - sess.CreatedAt; age < cfg.TransferMinAge {
+		return serviceError(http.StatusForbidden, fmt.Sprintf("Accounts can send credits %d seconds after they open", cfg.TransferMinAge))
+	}
+	voyages := 0
+	for _, s := range Fleets[pilotID] {
+		voyages += s.Voyages
+	}
+	if voyages < cfg.TransferMinVoyages {
+		return serviceError(http.StatusForbidden, fmt.Sprintf("Fly %d jumps before sending credits", cfg.TransferMinVoyages))
+	}
+	return nil
+}
+
+// sameOrigin reports whether two pilots' sessions were opened from the same
+// host, unless same_origin_transfers allows that. Pilots without a session
+// (NPCs) never match.
+func sameOrigin(a, b string) bool {
+	if CurrentUniverse.LedgerConfig.SameOriginTransfer {
+		return false
+	}
+	sa, okA := sessions.ForPilot(a)
+	sb, okB := sessions.ForPilot(b)
+	return okA && okB && sa.Origin == sb.Origin
+}
@@ -8,9 +8,10 @@ and runs the background heartbeat that keeps the economy alive.
 package main
 
 import (
-	"encoding/json" 
 	"log"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"os"
 	"os/signal"
 	"syscall"
@@ -20,51 +21,75 @@ import (
 // Declare gameHub at the package level so it's accessible to handlers.go
 var gameHub *Hub
 
+// primaryURL is set on replica instances (GALAXIES_PRIMARY_URL). The primary owns
+// the game state and heartbeat; replicas serve WebSockets and proxy /api/ to it.
+var primaryURL string
+
 func main() {
 	// 1. Load the static universe configuration from YAML
 	if err := LoadConfig(); err != nil {
 		log.Fatalf("Config Fail: %v", err)
 	}
 
+	primaryURL = os.Getenv("GALAXIES_PRIMARY_URL")
+
+	// Set GALAXIES_TRUSTED_PROXIES to the replicas' (and any reverse proxy's)
+	// addresses, comma separated, so their X-Forwarded-For names the real client.
+	proxies, err := parseTrustedProxies(os.Getenv("GALAXIES_TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("Trusted Proxies Fail: %v", err)
+	}
+	trustedProxies = proxies
+
 	// 2. Initial Population (Seeding the market)
 	// We call ReplenishMarket instead of GenerateJobBoard to respect the new limits.
-	log.Println("Seeding initial market...")
-	ReplenishMarket()
+	if primaryURL == "" {
+		log.Println("Seeding initial market...")
+		ReplenishMarket()
+		PostMissions()
+		PostCrew()
+	}
 
 	// 3. Initialize and start the Real-Time WebSocket Hub
-	gameHub = NewHub()
+	// Set GALAXIES_CHAT_LOG to a file path to keep chat history across restarts.
+	history, err := NewChatHistory(os.Getenv("GALAXIES_CHAT_LOG"))
+	if err != nil {
+		log.Fatalf("Chat History Fail: %v", err)
+	}
+
+	// Set GALAXIES_LEDGER_ARCHIVE to a file path to keep ledger entries that
+	// age out of /api/ledger.
+	if err := OpenLedgerArchive(os.Getenv("GALAXIES_LEDGER_ARCHIVE")); err != nil {
+		log.Fatalf("Ledger Archive Fail: %v", err)
+	}
+
+	// Set GALAXIES_BROKER_ADDR (host:port of Redis or compatible) to share the hub
+	// between instances. Without it the hub runs in-process.
+	var broker Broker = NewMemoryBroker()
+	if addr := os.Getenv("GALAXIES_BROKER_ADDR"); addr != "" {
+		redisBroker, err := NewRedisBroker(addr)
+		if err != nil {
+			log.Fatalf("Broker Fail: %v", err)
+		}
+		broker = redisBroker
+		log.Printf("Hub broker: %s", addr)
+	}
+
+	gameHub, err = NewHub(history, broker)
+	if err != nil {
+		log.Fatalf("Hub Fail: %v", err)
+	}
 	go gameHub.Run()
 
 	// 4. THE MARKET HEARTBEAT
 	// Runs every 60 seconds to top up planets that have dropped below minimums.
-	go func() {
-		ticker := time.NewTicker(60 * time.Second)
-		for range ticker.C {
-
-			// Update the market state and get a list of changed planets
-			updatedPlanets := ReplenishMarket()
-
-			if len(updatedPlanets) > 0 {
-				// Create the broadcast message
-				msg := map[string]interface{}{
-					"type":            "market_pulse",
-					"updated_planets": updatedPlanets,
-				}
-
-				// FIX: Marshal the map to JSON bytes before sending
-				jsonBytes, err := json.Marshal(msg)
-				if err != nil {
-					log.Printf("Error marshaling heartbeat: %v", err)
-					continue
-				}
-
-				// Send to all connected clients via the Hub
-				gameHub.broadcast <- jsonBytes
-
-				log.Printf("Market Pulse: Updated %d planets", len(updatedPlanets))
-			}
-		}
-	}()
+	// Each pulse carries per-planet board diffs since the previous pulse.
+	// Only the primary runs it; replicas hear the pulse through the broker.
+	if primaryURL == "" {
+		CollectMarketDiffs() // Baseline snapshot so the first pulse isn't the whole seed
+		go runHeartbeat()
+		go runAuctionClock()
+	}
 
 	// 5. Hot-reload logic: Listen for SIGHUP to refresh universe without restart
 	go func() {
@@ -81,19 +106,24 @@ func main() {
 	// 6. Setup Router and Handlers
 	mux := http.NewServeMux()
 
-	// Persistence & Information Endpoints
-	mux.HandleFunc("/api/ship", handleGetShip)
-	mux.HandleFunc("/api/planets", handleGetPlanets)
-	mux.HandleFunc("/api/contracts", handleGetContracts)
-	mux.HandleFunc("/api/contracts/drop", handleDropContract)
-	mux.HandleFunc("/api/modules", handleGetModules)
-
-	// Action Endpoints
-	mux.HandleFunc("/api/contracts/accept", handleAcceptContract)
-	mux.HandleFunc("/api/travel", handleTravel)
-	mux.HandleFunc("/api/travel/quote", handleTravelQuote)
-	mux.HandleFunc("/api/refuel", handleRefuel)
-	mux.HandleFunc("/api/modules/buy", handleBuyModule)
+	if primaryURL != "" {
+		target, err := url.Parse(primaryURL)
+		if err != nil {
+			log.Fatalf("Primary URL Fail: %v", err)
+		}
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.ModifyResponse = func(resp *http.Response) error {
+			// corsMiddleware sets these on our side; duplicates break browsers
+			resp.Header.Del("Access-Control-Allow-Origin")
+			resp.Header.Del("Access-Control-Allow-Methods")
+			resp.Header.Del("Access-Control-Allow-Headers")
+			return nil
+		}
+		mux.Handle("/api/", proxy)
+		log.Printf("Replica mode: proxying /api/ to %s", primaryURL)
+	} else {
+		registerAPI(mux)
+	}
 
 	// Real-Time WebSocket Endpoint
 	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
@@ -102,6 +132,9 @@ func main() {
 
 	// 7. Start the Server
 	port := ":8081"
+	if p := os.Getenv("GALAXIES_PORT"); p != "" {
+		port = ":" + p
+	}
 	log.Printf("GALAXIES: BURN RATE Server live on %s", port)
 	log.Printf("Real-time Hub: Online")
 
@@ -110,12 +143,123 @@ func main() {
 	}
 }
 
+// registerAPI mounts the game endpoints. Only the primary serves these. Anything
+// that acts as a pilot sits behind requireSession; the rest is public.
+func registerAPI(mux *http.ServeMux) {
+	// Sessions: the only way to get a token for the pilot endpoints below
+	mux.HandleFunc("/api/session", handleOpenSession)
+
+	// Persistence & Information Endpoints
+	mux.HandleFunc("/api/ship", requireSession(handleGetShip))
+	mux.HandleFunc("/api/planets", handleGetPlanets)
+	mux.HandleFunc("/api/contracts", requireSession(handleGetContracts))
+	mux.HandleFunc("/api/contracts/drop", requireSession(handleDropContract))
+	mux.HandleFunc("/api/modules", requireSession(handleGetModules))
+	mux.HandleFunc("/api/chat/history", handleGetChatHistory)
+	mux.HandleFunc("/api/presence", handleGetPresence)
+	mux.HandleFunc("/api/telemetry", handleGetTelemetry)
+	mux.HandleFunc("/api/stockpiles", handleGetStockpiles)
+	mux.HandleFunc("/api/events", handleGetEvents)
+	mux.HandleFunc("/api/npcs", handleGetNPCs)
+	mux.HandleFunc("/api/auctions", handleGetAuctions)
+	mux.HandleFunc("/api/contracts/posted", requireSession(handleGetPostings))
+	mux.HandleFunc("/api/missions", requireSession(handleGetMissions))
+	mux.HandleFunc("/api/reputation", requireSession(handleGetReputation))
+	mux.HandleFunc("/api/bank", requireSession(handleGetBank))
+	mux.HandleFunc("/api/insurance", requireSession(handleGetInsurance))
+	mux.HandleFunc("/api/repair/quote", requireSession(handleGetRepair))
+	mux.HandleFunc("/api/crew", requireSession(handleGetCrew))
+	mux.HandleFunc("/api/fleet", requireSession(handleGetFleet))
+	mux.HandleFunc("/api/fleet/classes", requireSession(handleGetShipClasses))
+	mux.HandleFunc("/api/corp", requireSession(handleGetCorp))
+	mux.HandleFunc("/api/corps", handleListCorps)
+	mux.HandleFunc("/api/corp/ledger", requireSession(handleGetCorpLedger))
+	mux.HandleFunc("/api/corp/contracts", requireSession(handleGetCorpContracts))
+	mux.HandleFunc("/api/corp/chat", requireSession(handleCorpChat))
+	mux.HandleFunc("/api/ledger", requireSession(handleGetLedger))
+
+	// Action Endpoints
+	mux.HandleFunc("/api/contracts/accept", requireSession(handleAcceptContract))
+	mux.HandleFunc("/api/travel", requireSession(handleTravel))
+	mux.HandleFunc("/api/travel/quote", requireSession(handleTravelQuote))
+	mux.HandleFunc("/api/refuel", requireSession(handleRefuel))
+	mux.HandleFunc("/api/modules/buy", requireSession(handleBuyModule))
+	mux.HandleFunc("/api/auctions/bid", requireSession(handleBid))
+	mux.HandleFunc("/api/contracts/post", requireSession(handlePostContract))
+	mux.HandleFunc("/api/contracts/cancel", requireSession(handleCancelPosting))
+	mux.HandleFunc("/api/missions/accept", requireSession(handleAcceptMission))
+	mux.HandleFunc("/api/missions/abandon", requireSession(handleAbandonMission))
+	mux.HandleFunc("/api/bank/borrow", requireSession(handleBorrow))
+	mux.HandleFunc("/api/bank/repay", requireSession(handleRepay))
+	mux.HandleFunc("/api/tow", requireSession(handleTow))
+	mux.HandleFunc("/api/insurance/buy", requireSession(handleBuyInsurance))
+	mux.HandleFunc("/api/repair", requireSession(handleRepair))
+	mux.HandleFunc("/api/crew/hire", requireSession(handleHireCrew))
+	mux.HandleFunc("/api/crew/dismiss", requireSession(handleDismissCrew))
+	mux.HandleFunc("/api/fleet/buy", requireSession(handleBuyShip))
+	mux.HandleFunc("/api/fleet/switch", requireSession(handleSwitchShip))
+	mux.HandleFunc("/api/fleet/route", requireSession(handleSetRoute))
+	mux.HandleFunc("/api/corp/create", requireSession(handleCreateCorp))
+	mux.HandleFunc("/api/corp/join", requireSession(handleJoinCorp))
+	mux.HandleFunc("/api/corp/leave", requireSession(handleLeaveCorp))
+	mux.HandleFunc("/api/corp/invite", requireSession(handleInviteToCorp))
+	mux.HandleFunc("/api/corp/kick", requireSession(handleKickFromCorp))
+	mux.HandleFunc("/api/corp/role", requireSession(handleSetCorpRole))
+	mux.HandleFunc("/api/corp/deposit", requireSession(handleCorpDeposit))
+	mux.HandleFunc("/api/corp/withdraw", requireSession(handleCorpWithdraw))
+	mux.HandleFunc("/api/corp/contracts/post", requireSession(handlePostCorpContract))
+	mux.HandleFunc("/api/corp/contracts/accept", requireSession(handleAcceptCorpContract))
+	mux.HandleFunc("/api/corp/contracts/cancel", requireSession(handleCancelCorpContract))
+	mux.HandleFunc("/api/transfer", requireSession(handleTransfer))
+}
+
+// runHeartbeat tops up the job boards every 60 seconds and sends the market pulse.
+func runHeartbeat() {
+	ticker := time.NewTicker(60 * time.Second)
+	for range ticker.C {
+
+		// Age and roll galactic events before the boards refill, so new jobs see them
+		started, ended := EventTick()
+		for _, e := range ended {
+			broadcastEvent("ended", e)
+		}
+		for _, e := range started {
+			broadcastEvent("started", e)
+			log.Printf("Galactic Event: %s at %s", e.Name, e.PlanetKey)
+		}
+
+		// NPC haulers compete for jobs before the boards are topped up
+		NPCTick()
+
+		// Automated player ships run their routes alongside the NPCs
+		FleetTick()
+
+		// Interest, defaults and repossessions, then wages
+		BankTick()
+		PayCrew()
+
+		// Update the market state, then diff every board against the last pulse
+		ReplenishMarket()
+		PostAuctions()
+		PostMissions()
+		PostCrew()
+		diffs := CollectMarketDiffs()
+
+		if len(diffs) > 0 {
+			// The Hub filters diffs per client subscription
+			gameHub.SendPulse(diffs)
+
+			log.Printf("Market Pulse: Updated %d planets", len(diffs))
+		}
+	}
+}
+
 // corsMiddleware ensures our Wails client can talk to the VPS across domains.
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Session-Token")
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 			return
@@ -0,0 +1,150 @@
+/*
+Package main
+File: maintenance.go
+Description: Ship wear and repair. Hull and engine condition (100 = new) wear down
+with every LY flown, faster when the ship is heavy and, for the hull, on rough
+lanes. A worn engine loses efficiency and a battered hull adds drag, both raising
+the burn rate; a battered hull also makes transit incidents likelier. Planets
+with a repair yard fix either part, priced per point of damage.
+*/
+
+package main
+
+import (
+	"math"
+	"net/http"
+)
+
+// Repairable parts
+const (
+	PartHull   = "hull"
+	PartEngine = "engine"
+)
+
+// MaintenanceConfig tunes wear and repair from YAML.
+type MaintenanceConfig struct {
+	HullWearPerLY        float64 `yaml:"hull_wear_per_ly" json:"hull_wear_per_ly"`             // Condition lost per LY at base mass
+	EngineWearPerLY      float64 `yaml:"engine_wear_per_ly" json:"engine_wear_per_ly"`         // Condition lost per LY at base mass
+	HazardWearMult       float64 `yaml:"hazard_wear_mult" json:"hazard_wear_mult"`             // Hull wear * (1 + this * lane hazard)
+	EngineEfficiencyLoss float64 `yaml:"engine_efficiency_loss" json:"engine_efficiency_loss"` // Efficiency lost at 0 engine condition
+	HullDrag             float64 `yaml:"hull_drag" json:"hull_drag"`                           // Extra burn at 0 hull condition
+	HullRiskMult         float64 `yaml:"hull_risk_mult" json:"hull_risk_mult"`                 // Extra incident odds at 0 hull condition
+	HullRepairCost       int     `yaml:"hull_repair_cost" json:"hull_repair_cost"`             // Credits per point
+	EngineRepairCost     int     `yaml:"engine_repair_cost" json:"engine_repair_cost"`         // Credits per point
+	NPCRepairBelow       float64 `yaml:"npc_repair_below" json:"npc_repair_below"`             // NPCs repair when a part drops below this
+}
+
+// RepairQuote is the price of restoring a ship at its current planet.
+type RepairQuote struct {
+	PlanetKey  string  `json:"planet_key"`
+	Available  bool    `json:"available"` // The planet has a repair yard
+	Hull       float64 `json:"hull"`
+	Engine     float64 `json:"engine"`
+	HullCost   int     `json:"hull_cost"`   // Full hull repair
+	EngineCost int     `json:"engine_cost"` // Full engine repair
+}
+
+// damage is the points a condition is below new.
+func damage(condition float64) float64 {
+	return math.Max(0, 100-condition)
+}
+
+// effectiveEfficiency is the engine's mass-to-burn divisor after wear.
+func effectiveEfficiency(ship *Ship) int64 {
+	loss := CurrentUniverse.MaintenanceConfig.EngineEfficiencyLoss * damage(ship.EngineCondition) / 100
+	eff := int64(float64(ship.Efficiency) * (1 - loss))
+	if eff < 1 {
+		return 1
+	}
+	return eff
+}
+
+// hullDragMult scales burn for hull damage.
+func hullDragMult(ship *Ship) float64 {
+	return 1 + CurrentUniverse.MaintenanceConfig.HullDrag*damage(ship.HullCondition)/100
+}
+
+// hullRiskMult scales transit incident odds for hull damage.
+func hullRiskMult(ship *Ship) float64 {
+	return 1 + CurrentUniverse.MaintenanceConfig.HullRiskMult*damage(ship.HullCondition)/100
+}
+
+// wearShip ages the hull and engine for dist LY on a lane of the given hazard.
+// Call before unloading so the cargo's mass counts.
+func wearShip(ship *Ship, dist int64, hazard float64) {
+	cfg := CurrentUniverse.MaintenanceConfig
+	load := 1.0
+	if ship.BaseMass > 0 {
+		load = float64(CalculateTotalMass(ship)) / float64(ship.BaseMass)
+	}
+	ly := float64(dist) * load
+	ship.HullCondition = math.Max(0, ship.HullCondition-ly*cfg.HullWearPerLY*(1+cfg.HazardWearMult*hazard))
+	ship.EngineCondition = math.Max(0, ship.EngineCondition-ly*cfg.EngineWearPerLY)
+}
+
+// QuoteRepair prices full repairs at the ship's planet.
+func QuoteRepair(ship *Ship) RepairQuote {
+	cfg := CurrentUniverse.MaintenanceConfig
+	quote := RepairQuote{PlanetKey: ship.LocationKey, Hull: ship.HullCondition, Engine: ship.EngineCondition}
+	planet := GetPlanet(ship.LocationKey)
+	if planet == nil || planet.RepairPriceMult <= 0 {
+		return quote
+	}
+	mult := planet.RepairPriceMult * standingPriceMult(ship.PilotID, planet.Key)
+	quote.Available = true
+	quote.HullCost = int(math.Ceil(damage(ship.HullCondition) * float64(cfg.HullRepairCost) * mult))
+	quote.EngineCost = int(math.Ceil(damage(ship.EngineCondition) * float64(cfg.EngineRepairCost) * mult))
+	return quote
+}
+
+// RepairShip fixes a part ("hull", "engine", or "" for both), as far as the
+// pilot's credits go. Returns the credits spent. Caller holds dataLock.
+func RepairShip(ship *Ship, part string) (int, error) {
+	quote := QuoteRepair(ship)
+	if !quote.Available {
+		return 0, serviceError(http.StatusForbidden, "No repair yard at this location")
+	}
+
+	parts := []string{PartHull, PartEngine}
+	switch part {
+	case "":
+	case PartHull, PartEngine:
+		parts = []string{part}
+	default:
+		return 0, serviceError(http.StatusBadRequest, "Part must be hull or engine")
+	}
+
+	spent, needed := 0, false
+	for _, p := range parts {
+		condition, cost := &ship.HullCondition, quote.HullCost
+		if p == PartEngine {
+			condition, cost = &ship.EngineCondition, quote.EngineCost
+		}
+		points := damage(*condition)
+		if points <= 0 || cost <= 0 {
+			continue
+		}
+		needed = true
+
+		// Partial repair: buy whole points while credits last
+		perPoint := float64(cost) / points
+		if cost > ship.Credits {
+			points = math.Floor(float64(ship.Credits) / perPoint)
+			cost = int(math.Ceil(points * perPoint))
+		}
+		if points <= 0 {
+			continue
+		}
+		*condition = math.Min(100, *condition+points)
+		moveCredits(ship, -cost, LedgerEntry{Reason: "repair", Note: p})
+		spent += cost
+	}
+
+	if !needed {
+		return 0, serviceError(http.StatusBadRequest, "Nothing to repair")
+	}
+	if spent == 0 {
+		return 0, serviceError(http.StatusPaymentRequired, "Insufficient credits")
+	}
+	return spent, nil
+}
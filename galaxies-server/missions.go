@@ -0,0 +1,245 @@
+/*
+Package main
+File: missions.go
+Description: Multi-leg mission chains. Missions are scripted in universe.yaml as
+ordered legs, each picked up at one planet and dropped at another. Only the current
+leg rides aboard (as an ordinary Contract tagged with the mission); it is loaded
+when the ship docks at its pickup and pays out on dropoff like any other job.
+Finishing the last leg pays the completion bonus.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// MissionConfig controls how many missions are on offer.
+type MissionConfig struct {
+	PostsPerTick int `yaml:"posts_per_tick" json:"posts_per_tick"`
+	MaxOffered   int `yaml:"max_offered" json:"max_offered"`
+}
+
+// MissionLeg is one pickup -> dropoff hop of a mission.
+type MissionLeg struct {
+	PickupKey  string `yaml:"pickup" json:"pickup_key"`
+	DropoffKey string `yaml:"dropoff" json:"dropoff_key"`
+	Type       string `yaml:"type" json:"type"`         // "cargo" or "passenger"
+	ItemKey    string `yaml:"item_key" json:"item_key"` // Commodity (cargo only)
+	Quantity   int    `yaml:"quantity" json:"quantity"`
+	Payout     int    `yaml:"payout" json:"payout"` // Paid on dropoff
+	Text       string `yaml:"text" json:"text"`     // Shown when the leg is loaded
+	Status     string `yaml:"-" json:"status"`      // "pending", "aboard", "delivered"
+}
+
+// MissionTemplate is a mission chain from YAML.
+type MissionTemplate struct {
+	Key             string       `yaml:"key"`
+	Name            string       `yaml:"name"`
+	Briefing        string       `yaml:"briefing"`
+	Debrief         string       `yaml:"debrief"`
+	CompletionBonus int          `yaml:"completion_bonus"`
+	Weight          int          `yaml:"weight"`
+	Legs            []MissionLeg `yaml:"legs"`
+}
+
+// Mission is an offered or accepted instance of a template.
+type Mission struct {
+	ID              string       `json:"id"`
+	Key             string       `json:"key"`
+	Name            string       `json:"name"`
+	Briefing        string       `json:"briefing"`
+	Debrief         string       `json:"debrief"`
+	CompletionBonus int          `json:"completion_bonus"`
+	Legs            []MissionLeg `json:"legs"`
+	CurrentLeg      int          `json:"current_leg"`
+}
+
+// legContract turns a leg into the Contract carried in the hold.
+func (m *Mission) legContract(i int) Contract {
+	leg := m.Legs[i]
+	origin := GetPlanet(leg.PickupKey)
+	dest := GetPlanet(leg.DropoffKey)
+	c := Contract{
+		ID:             fmt.Sprintf("%s-L%d", m.ID, i+1),
+		Type:           leg.Type,
+		Quantity:       leg.Quantity,
+		OriginKey:      leg.PickupKey,
+		DestinationKey: leg.DropoffKey,
+		Payout:         leg.Payout,
+		MissionID:      m.ID,
+		Faction:        factionOf(leg.PickupKey),
+	}
+	if origin != nil && dest != nil {
+		c.DirectDistance = CalculateDistance(origin.Coordinates, dest.Coordinates)
+	}
+	if leg.Type == "passenger" {
+		c.ItemName = defaultPassengerClass.Name
+		c.ItemKey = "passenger"
+		c.MassPerUnit = CurrentUniverse.PassengerConfig.MassPerPassenger
+		c.PassengerClass = defaultPassengerClass.Key
+		c.Satisfaction = 100
+	} else if comm := GetCommodity(leg.ItemKey); comm != nil {
+		c.setCommodity(comm)
+	}
+	return c
+}
+
+// AvailableMissions maps the first pickup PlanetKey -> offered missions. Guarded by dataLock.
+var AvailableMissions = make(map[string][]Mission)
+
+// PostMissions offers new missions from the YAML templates, one offer per template at a time.
+func PostMissions() {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+
+	cfg := CurrentUniverse.MissionConfig
+	offered := map[string]bool{}
+	count := 0
+	for _, board := range AvailableMissions {
+		for _, m := range board {
+			offered[m.Key] = true
+			count++
+		}
+	}
+
+	for i := 0; i < cfg.PostsPerTick && count < cfg.MaxOffered; i++ {
+		total := 0
+		for _, t := range CurrentUniverse.Missions {
+			if !offered[t.Key] && len(t.Legs) > 0 {
+				total += t.Weight
+			}
+		}
+		if total <= 0 {
+			return
+		}
+
+		roll := rand.Intn(total)
+		for _, t := range CurrentUniverse.Missions {
+			if offered[t.Key] || len(t.Legs) == 0 {
+				continue
+			}
+			if roll >= t.Weight {
+				roll -= t.Weight
+				continue
+			}
+			m := Mission{
+				ID:              fmt.Sprintf("MSN-%d-%d", rand.Intn(99999), time.Now().UnixNano()%1000),
+				Key:             t.Key,
+				Name:            t.Name,
+				Briefing:        t.Briefing,
+				Debrief:         t.Debrief,
+				CompletionBonus: t.CompletionBonus,
+				Legs:            append([]MissionLeg{}, t.Legs...),
+			}
+			for j := range m.Legs {
+				m.Legs[j].Status = "pending"
+			}
+			start := m.Legs[0].PickupKey
+			AvailableMissions[start] = append(AvailableMissions[start], m)
+			offered[t.Key] = true
+			count++
+			break
+		}
+	}
+}
+
+// AcceptMission takes a mission from the local board and loads the first leg.
+// Caller holds dataLock.
+func AcceptMission(ship *Ship, missionID string) (Mission, error) {
+	board := AvailableMissions[ship.LocationKey]
+	for i, m := range board {
+		if m.ID != missionID {
+			continue
+		}
+		first := m.legContract(0)
+		if err := canCarry(ship, first); err != nil {
+			return Mission{}, err
+		}
+		AvailableMissions[ship.LocationKey] = append(board[:i], board[i+1:]...)
+		m.Legs[0].Status = "aboard"
+		ship.ActiveContracts = append(ship.ActiveContracts, first)
+		ship.ActiveMissions = append(ship.ActiveMissions, m)
+		return m, nil
+	}
+	return Mission{}, serviceError(http.StatusNotFound, "Mission not found")
+}
+
+// AbandonMission drops a mission and whichever leg is aboard, returning the
+// dropped leg. Caller holds dataLock.
+func AbandonMission(ship *Ship, missionID string) ([]Contract, error) {
+	found := false
+	remaining := []Mission{}
+	for _, m := range ship.ActiveMissions {
+		if m.ID == missionID {
+			found = true
+			continue
+		}
+		remaining = append(remaining, m)
+	}
+	if !found {
+		return nil, serviceError(http.StatusNotFound, "Mission not active")
+	}
+	ship.ActiveMissions = remaining
+
+	contracts := []Contract{}
+	dropped := []Contract{}
+	for _, c := range ship.ActiveContracts {
+		if c.MissionID == missionID {
+			dropped = append(dropped, c)
+			continue
+		}
+		contracts = append(contracts, c)
+	}
+	ship.ActiveContracts = contracts
+	return dropped, nil
+}
+
+// MissionProgress is what happened to a ship's missions on arrival.
+type MissionProgress struct {
+	Mission Mission `json:"mission"`
+	Event   string  `json:"event"` // "leg_delivered", "leg_loaded", "leg_waiting", "completed"
+	Text    string  `json:"text,omitempty"`
+}
+
+// advanceMissions runs after TravelShip's deliveries: it closes delivered legs,
+// pays completion bonuses and loads legs waiting at this planet. Caller holds dataLock.
+func advanceMissions(ship *Ship, result *TravelResult) {
+	delivered := map[string]bool{}
+	for _, c := range result.Delivered {
+		if c.MissionID != "" {
+			delivered[c.MissionID] = true
+		}
+	}
+
+	remaining := []Mission{}
+	for _, m := range ship.ActiveMissions {
+		if delivered[m.ID] {
+			m.Legs[m.CurrentLeg].Status = "delivered"
+			m.CurrentLeg++
+			if m.CurrentLeg >= len(m.Legs) {
+				result.Payout += m.CompletionBonus
+				result.Missions = append(result.Missions, MissionProgress{Mission: m, Event: "completed", Text: m.Debrief})
+				continue
+			}
+			result.Missions = append(result.Missions, MissionProgress{Mission: m, Event: "leg_delivered"})
+		}
+
+		leg := &m.Legs[m.CurrentLeg]
+		if leg.Status == "pending" && leg.PickupKey == ship.LocationKey {
+			next := m.legContract(m.CurrentLeg)
+			if err := canCarry(ship, next); err != nil {
+				result.Missions = append(result.Missions, MissionProgress{Mission: m, Event: "leg_waiting", Text: err.Error()})
+			} else {
+				leg.Status = "aboard"
+				ship.ActiveContracts = append(ship.ActiveContracts, next)
+				result.Missions = append(result.Missions, MissionProgress{Mission: m, Event: "leg_loaded", Text: leg.Text})
+			}
+		}
+		remaining = append(remaining, m)
+	}
+	ship.ActiveMissions = remaining
+}
@@ -0,0 +1,188 @@
+/*
+Package main
+File: npc.go
+Description: NPC haulers. Each heartbeat the primary lets its NPC traders refuel,
+take jobs off the boards and fly them, using the same services as players, so the
+economy keeps moving in quiet sessions. A trader stranded without the fuel for any
+jump is retired and replaced by a fresh ship. Tuned by npc_traders in universe.yaml.
+*/
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+)
+
+// NPCConfig sets how many NPC traders run on this server and how hard they compete.
+type NPCConfig struct {
+	Count          int      `yaml:"count" json:"count"`
+	Aggressiveness float64  `yaml:"aggressiveness" json:"aggressiveness"` // 0.0-1.0: chance to act per tick and to take the best job
+	MaxJobsPerStop int      `yaml:"max_jobs_per_stop" json:"max_jobs_per_stop"`
+	Names          []string `yaml:"names" json:"names"`
+}
+
+// NPCs is guarded by dataLock. NPC ships are not in Pilots and never appear in presence.
+var NPCs = []*Ship{}
+
+// InitNPCs grows or shrinks the fleet to the configured count. Existing NPCs keep
+// flying across a config reload. Caller holds dataLock.
+func InitNPCs() {
+	cfg := CurrentUniverse.NPCConfig
+	if cfg.Count < len(NPCs) {
+		NPCs = NPCs[:cfg.Count]
+	}
+	for i := len(NPCs); i < cfg.Count; i++ {
+		NPCs = append(NPCs, spawnNPC(i))
+	}
+}
+
+// spawnNPC commissions the i-th trader at a random planet.
+func spawnNPC(i int) *Ship {
+	cfg := CurrentUniverse.NPCConfig
+	ship := newShip(fmt.Sprintf("npc-%d", i+1))
+	ship.Name = fmt.Sprintf("Trader %d", i+1)
+	if i < len(cfg.Names) {
+		ship.Name = cfg.Names[i]
+	}
+	if len(CurrentUniverse.Planets) > 0 {
+		ship.LocationKey = CurrentUniverse.Planets[rand.Intn(len(CurrentUniverse.Planets))].Key
+	}
+	return ship
+}
+
+// NPCTick lets every NPC take one action: refuel, fly its jobs, or load up.
+func NPCTick() {
+	dataLock.Lock()
+	defer dataLock.Unlock()
+
+	cfg := CurrentUniverse.NPCConfig
+	for i, ship := range NPCs {
+		if rand.Float64() >= cfg.Aggressiveness {
+			continue // Idling this tick
+		}
+
+		// 1. Top up when below half a tank (if it can afford to)
+		if ship.Fuel < ship.MaxFuel/2 {
+			RefuelShip(ship)
+		}
+		if min := CurrentUniverse.MaintenanceConfig.NPCRepairBelow; ship.HullCondition < min || ship.EngineCondition < min {
+			RepairShip(ship, "")
+		}
+		if shipStranded(ship) {
+			log.Printf("NPC %s is stranded at %s and retires", ship.Name, ship.LocationKey)
+			releaseNPCContracts(ship)
+			NPCs[i] = spawnNPC(i)
+			continue
+		}
+
+		// 2. Fly the oldest job home
+		if len(ship.ActiveContracts) > 0 {
+			npcFly(ship, ship.ActiveContracts[0].DestinationKey)
+			continue
+		}
+
+		// 3. Load up, or reposition if the board has nothing worth taking
+		if npcLoad(ship, cfg) == 0 {
+			others := []string{}
+			for _, p := range CurrentUniverse.Planets {
+				if p.Key != ship.LocationKey {
+					others = append(others, p.Key)
+				}
+			}
+			if len(others) > 0 {
+				npcFly(ship, others[rand.Intn(len(others))])
+			}
+		}
+	}
+}
+
+// npcFly jumps to a destination. An NPC that can't make the jump abandons its
+// jobs rather than sitting on them forever.
+func npcFly(ship *Ship, destKey string) {
+	result, err := TravelShip(ship, destKey)
+	if err != nil {
+		if len(ship.ActiveContracts) > 0 {
+			log.Printf("NPC %s abandoned %d contracts: %v", ship.Name, len(ship.ActiveContracts), err)
+			releaseNPCContracts(ship)
+		}
+		return
+	}
+	notifyPosters(result.Delivered)
+	if len(result.Delivered) > 0 {
+		log.Printf("NPC %s delivered %d contracts at %s for %d CR", ship.Name, len(result.Delivered), destKey, result.Payout)
+	}
+}
+
+// releaseNPCContracts empties an NPC's hold: posters get their escrow back and
+// generated cargo goes back into its origin's stockpile, where ReplenishMarket
+// can post it again at a fresh price. Handling losses and repricing on the
+// abandoned jobs die with them.
+func releaseNPCContracts(ship *Ship) {
+	for _, c := range ship.ActiveContracts {
+		if c.PostedBy != "" {
+			refundEscrow(c)
+			continue
+		}
+		if c.Type == "cargo" {
+			AddStock(c.OriginKey, c.ItemKey, c.Quantity)
+		}
+	}
+	ship.ActiveContracts = []Contract{}
+}
+
+// npcLoad accepts jobs from the local board, all bound for the same destination.
+// Aggressive NPCs take the best credits-per-LY jobs; timid ones pick at random.
+// Returns how many were accepted.
+func npcLoad(ship *Ship, cfg NPCConfig) int {
+	board := AvailableContracts[ship.LocationKey]
+	candidates := []Contract{}
+	for _, c := range board {
+		if canCarry(ship, c) == nil && checkStanding(ship.PilotID, c) == nil {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		return 0
+	}
+
+	if rand.Float64() < cfg.Aggressiveness {
+		sort.Slice(candidates, func(i, j int) bool {
+			return npcScore(candidates[i]) > npcScore(candidates[j])
+		})
+	} else {
+		rand.Shuffle(len(candidates), func(i, j int) {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		})
+	}
+
+	limit := cfg.MaxJobsPerStop
+	if limit <= 0 {
+		limit = 1
+	}
+	destKey := candidates[0].DestinationKey
+	accepted := 0
+	for _, c := range candidates {
+		if accepted >= limit {
+			break
+		}
+		if c.DestinationKey != destKey {
+			continue
+		}
+		if _, err := AcceptContract(ship, c.ID); err == nil {
+			accepted++
+		}
+	}
+	return accepted
+}
+
+// npcScore is credits per light year.
+func npcScore(c Contract) float64 {
+	dist := c.DirectDistance
+	if dist < 1 {
+		dist = 1
+	}
+	return float64(c.Payout) / float64(dist)
+}
@@ -0,0 +1,130 @@
+/*
+Package main
+File: passengers.go
+Description: Passenger classes and satisfaction. Each class has its own fare
+multiplier, party size and cabin comfort requirement; passengers grow unhappy
+the further a trip strays from the direct route, which scales the fare paid.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// PassengerClass is a ticket tier defined in passenger_config.classes.
+type PassengerClass struct {
+	Key                string  `yaml:"key" json:"key"`
+	Name               string  `yaml:"name" json:"name"`
+	TicketMult         float64 `yaml:"ticket_mult" json:"ticket_mult"`                 // Fare multiplier per head
+	MinGroup           int     `yaml:"min_group" json:"min_group"`                     // Party size range
+	MaxGroup           int     `yaml:"max_group" json:"max_group"`                     //
+	ComfortRequirement int     `yaml:"comfort_requirement" json:"comfort_requirement"` // Minimum Ship.Comfort to board
+	Weight             int     `yaml:"weight" json:"weight"`                           // Relative spawn odds
+}
+
+// defaultPassengerClass matches the original single-passenger contracts, used
+// when the YAML defines no classes.
+var defaultPassengerClass = PassengerClass{
+	Key: "economy", Name: "Passenger", TicketMult: 1.0, MinGroup: 1, MaxGroup: 1, Weight: 1,
+}
+
+// pickPassengerClass rolls a class using the configured weights.
+func pickPassengerClass() PassengerClass {
+	classes := CurrentUniverse.PassengerConfig.Classes
+	total := 0
+	for _, c := range classes {
+		total += c.Weight
+	}
+	if total <= 0 {
+		return defaultPassengerClass
+	}
+	roll := rand.Intn(total)
+	for _, c := range classes {
+		if roll < c.Weight {
+			return c
+		}
+		roll -= c.Weight
+	}
+	return defaultPassengerClass
+}
+
+// generatePassengerJobs creates 'count' new passenger contracts.
+func generatePassengerJobs(origin *Planet, count int) {
+	cfg := CurrentUniverse.PassengerConfig
+	for i := 0; i < count; i++ {
+		dest := CurrentUniverse.Planets[rand.Intn(len(CurrentUniverse.Planets))]
+		for dest.Key == origin.Key {
+			dest = CurrentUniverse.Planets[rand.Intn(len(CurrentUniverse.Planets))]
+		}
+
+		class := pickPassengerClass()
+		size := class.MinGroup
+		if class.MaxGroup > class.MinGroup {
+			size += rand.Intn(class.MaxGroup - class.MinGroup + 1)
+		}
+		if size < 1 {
+			size = 1
+		}
+
+		dist := CalculateDistance(origin.Coordinates, dest.Coordinates)
+		perHead := int(dist)*cfg.DistancePayoutMult + cfg.BaseTicketPrice
+		eventMult := EventPayoutMult(origin.Key, dest.Key)
+		payout := int(float64(perHead*size) * class.TicketMult * eventMult)
+
+		job := Contract{
+			ID:              fmt.Sprintf("PAX-%d-%d", rand.Intn(99999), time.Now().UnixNano()%1000),
+			Type:            "passenger",
+			ItemName:        class.Name,
+			ItemKey:         "passenger",
+			Quantity:        size,
+			MassPerUnit:     cfg.MassPerPassenger,
+			OriginKey:       origin.Key,
+			DestinationKey:  dest.Key,
+			Payout:          payout,
+			DirectDistance:  dist,
+			PassengerClass:  class.Key,
+			ComfortRequired: class.ComfortRequirement,
+			Satisfaction:    100,
+			eventMult:       eventMult,
+		}
+		tagFaction(&job, rand.Float64())
+		AvailableContracts[origin.Key] = append(AvailableContracts[origin.Key], job)
+	}
+}
+
+// passengerSatisfaction scores a trip: 100 on the direct route, minus
+// mood_decay_per_ly for every LY of detour, plus comfort_bonus per point of cabin
+// comfort above the class requirement. Clamped to 0-120.
+func passengerSatisfaction(c Contract, ship *Ship) int {
+	cfg := CurrentUniverse.PassengerConfig
+
+	score := 100
+	if detour := c.DistanceFlown - c.DirectDistance; detour > 0 {
+		score -= int(detour) * cfg.MoodDecayPerLY
+	}
+	if surplus := ship.Comfort - c.ComfortRequired; surplus > 0 {
+		score += surplus * cfg.ComfortBonus
+	}
+	score += int(crewEffect(ship, RoleMedic))
+
+	if score < 0 {
+		score = 0
+	}
+	if score > 120 {
+		score = 120
+	}
+	return score
+}
+
+// passengerFare is what a passenger contract actually pays on arrival: unhappy
+// passengers pay at least half, delighted ones tip up to 20%.
+func passengerFare(c Contract) int {
+	mood := c.Satisfaction
+	if mood < 50 {
+		mood = 50
+	}
+	return c.Payout * mood / 100
+}
@@ -0,0 +1,184 @@
+/*
+Package main
+File: postings.go
+Description: Player-posted contracts. A pilot funds a cargo or passenger job from
+their own credits, which are held in escrow on the contract while it sits on the
+origin's board or rides in another pilot's hold. Delivery pays the carrier from
+escrow; cancelling or a carrier dropping the job refunds the poster. Corp
+contracts (see corp.go) settle against the corp treasury instead.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// PostContractRequest describes a job a pilot wants flown.
+type PostContractRequest struct {
+	Type           string `json:"type"`     // "cargo" or "passenger"
+	ItemKey        string `json:"item_key"` // Commodity key (cargo only)
+	Quantity       int    `json:"quantity"`
+	OriginKey      string `json:"origin_key"`
+	DestinationKey string `json:"destination_key"`
+	Payout         int    `json:"payout"` // Escrowed from the poster's credits
+}
+
+// Posting is a player contract and where it currently is.
+type Posting struct {
+	Contract Contract `json:"contract"`
+	Status   string   `json:"status"`            // "open" (on a board) or "in_transit"
+	Carrier  string   `json:"carrier,omitempty"` // Pilot or NPC hauling it
+}
+
+// PostContract escrows the payout and lists the job on the origin's board.
+// Caller holds dataLock.
+func PostContract(ship *Ship, req PostContractRequest) (Contract, error) {
+	job, err := newPosting(ship.PilotID, req)
+	if err != nil {
+		return Contract{}, err
+	}
+	if err := checkSender(ship.PilotID); err != nil {
+		return Contract{}, err
+	}
+	if ship.Credits < job.Escrow {
+		return Contract{}, serviceError(http.StatusPaymentRequired, "Insufficient credits to fund escrow")
+	}
+
+	moveCredits(ship, -job.Escrow, LedgerEntry{Reason: "contract_escrow", ContractID: job.ID})
+	AvailableContracts[job.OriginKey] = append(AvailableContracts[job.OriginKey], job)
+	return job, nil
+}
+
+// newPosting validates a request and builds the job, escrow included but not
+// yet funded. Shared by pilot and corp postings.
+func newPosting(posterID string, req PostContractRequest) (Contract, error) {
+	origin := GetPlanet(req.OriginKey)
+	dest := GetPlanet(req.DestinationKey)
+	if origin == nil || dest == nil || origin.Key == dest.Key {
+		return Contract{}, serviceError(http.StatusBadRequest, "Origin and destination must be two different planets")
+	}
+	if req.Quantity <= 0 || req.Payout <= 0 {
+		return Contract{}, serviceError(http.StatusBadRequest, "Quantity and payout must be positive")
+	}
+
+	job := Contract{
+		ID:             fmt.Sprintf("PLR-%d-%d", rand.Intn(99999), time.Now().UnixNano()%1000),
+		Type:           req.Type,
+		Quantity:       req.Quantity,
+		OriginKey:      origin.Key,
+		DestinationKey: dest.Key,
+		Payout:         req.Payout,
+		DirectDistance: CalculateDistance(origin.Coordinates, dest.Coordinates),
+		PostedBy:       posterID,
+		Escrow:         req.Payout,
+	}
+	switch req.Type {
+	case "cargo":
+		comm := GetCommodity(req.ItemKey)
+		if comm == nil {
+			return Contract{}, serviceError(http.StatusNotFound, "Commodity not found")
+		}
+		job.setCommodity(comm)
+	case "passenger":
+		job.ItemName = defaultPassengerClass.Name
+		job.ItemKey = "passenger"
+		job.MassPerUnit = CurrentUniverse.PassengerConfig.MassPerPassenger
+		job.PassengerClass = defaultPassengerClass.Key
+		job.Satisfaction = 100
+	default:
+		return Contract{}, serviceError(http.StatusBadRequest, "Type must be cargo or passenger")
+	}
+	return job, nil
+}
+
+// CancelPosting pulls an unaccepted job off its board and refunds the escrow.
+// Caller holds dataLock.
+func CancelPosting(ship *Ship, contractID string) (Contract, error) {
+	for planetKey, board := range AvailableContracts {
+		for i, c := range board {
+			if c.ID != contractID {
+				continue
+			}
+			if c.PostedBy != ship.PilotID {
+				return Contract{}, serviceError(http.StatusForbidden, "Not your contract")
+			}
+			AvailableContracts[planetKey] = append(board[:i], board[i+1:]...)
+			moveCredits(ship, c.Escrow, LedgerEntry{Reason: "escrow_refund", ContractID: c.ID})
+			return c, nil
+		}
+	}
+	return Contract{}, serviceError(http.StatusNotFound, "Contract not on any board (already accepted?)")
+}
+
+// releaseEscrow settles a delivered player contract: the carrier has been paid,
+// and whatever was withheld (passenger mood, damaged goods) goes back to the poster.
+// Caller holds dataLock.
+func releaseEscrow(c Contract, refund int) {
+	if corp, ok := Corps[c.CorpID]; ok {
+		if refund > 0 {
+			corp.record("", "contract_settled", refund, c.ID)
+		}
+		return
+	}
+	if poster, ok := Pilots[c.PostedBy]; ok && refund > 0 {
+		moveCredits(poster, refund, LedgerEntry{Reason: "escrow_returned", ContractID: c.ID})
+	}
+}
+
+// refundEscrow returns a dropped player contract's full escrow to its poster.
+// Caller holds dataLock.
+func refundEscrow(c Contract) {
+	if corp, ok := Corps[c.CorpID]; ok {
+		corp.record("", "contract_refund", c.Escrow, c.ID)
+		for member := range corp.Members {
+			gameHub.SendToPilot(member, "contract_dropped", c)
+		}
+		return
+	}
+	poster, ok := Pilots[c.PostedBy]
+	if !ok {
+		return
+	}
+	moveCredits(poster, c.Escrow, LedgerEntry{Reason: "escrow_refund", ContractID: c.ID})
+	gameHub.SendToPilot(poster.PilotID, "contract_dropped", c)
+	notifyShip(poster)
+}
+
+// notifyPosters tells posters their delivered contracts are fulfilled.
+// Caller holds dataLock.
+func notifyPosters(delivered []Contract) {
+	for _, c := range delivered {
+		poster, ok := Pilots[c.PostedBy]
+		if !ok {
+			continue
+		}
+		gameHub.SendToPilot(poster.PilotID, "contract_fulfilled", c)
+		notifyShip(poster)
+	}
+}
+
+// PostingsBy finds every contract a pilot has posted, on boards or in transit.
+// Caller holds dataLock.
+func PostingsBy(pilotID string) []Posting {
+	out := []Posting{}
+	for _, board := range AvailableContracts {
+		for _, c := range board {
+			if c.PostedBy == pilotID {
+				out = append(out, Posting{Contract: c, Status: "open"})
+			}
+		}
+	}
+	carriers := append(allPlayerShips(), NPCs...)
+	for _, s := range carriers {
+		for _, c := range s.ActiveContracts {
+			if c.PostedBy == pilotID {
+				out = append(out, Posting{Contract: c, Status: "in_transit", Carrier: s.PilotID})
+			}
+		}
+	}
+	return out
+}
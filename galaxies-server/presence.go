@@ -0,0 +1,190 @@
+/*
+Package main
+File: presence.go
+Description: Tracks which pilots are connected and where their ships are docked,
+so clients can draw other ships on the StarMap and list pilots in port.
+Jumps resolve instantly on the server, so a pilot who just jumped is shown
+"in_transit" (from FromKey to LocationKey) until ArrivesAt, a flight time of
+transitSecondsPerLY per light year, and counts as docked after that.
+*/
+
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Presence is the public view of a pilot.
+type Presence struct {
+	PilotID     string `json:"pilot_id"`
+	ShipName    string `json:"ship_name"`
+	Status      string `json:"status"`       // "online", "in_transit" or "offline"
+	LocationKey string `json:"location_key"` // Destination while in transit
+	FromKey     string `json:"from_key,omitempty"`
+	ArrivesAt   int64  `json:"arrives_at,omitempty"` // Unix seconds, set while in transit
+	LastSeen    int64  `json:"last_seen"`            // Unix seconds
+
+	connections int  // Open WebSocket connections for this pilot
+	online      bool // Status to fall back to once a jump lands
+}
+
+// transitSecondsPerLY is how long a jump is shown on the map per light year.
+const transitSecondsPerLY = 3
+
+// settle lands a pilot whose jump has reached its ETA. Caller holds t.mu.
+func (p *Presence) settle(now int64) {
+	if p.Status != "in_transit" || now < p.ArrivesAt {
+		return
+	}
+	p.Status = "offline"
+	if p.online {
+		p.Status = "online"
+	}
+	p.FromKey, p.ArrivesAt = "", 0
+}
+
+// PresenceTracker is safe for concurrent use by the hub and HTTP handlers.
+type PresenceTracker struct {
+	mu     sync.RWMutex
+	pilots map[string]*Presence
+}
+
+func NewPresenceTracker() *PresenceTracker {
+	return &PresenceTracker{pilots: make(map[string]*Presence)}
+}
+
+// Connect registers a new connection. Returns the updated presence and whether
+// the pilot just came online.
+func (t *PresenceTracker) Connect(pilotID, shipName, locationKey string) (Presence, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.pilots[pilotID]
+	if !ok {
+		p = &Presence{PilotID: pilotID}
+		t.pilots[pilotID] = p
+	}
+	p.connections++
+	p.ShipName = shipName
+	p.LocationKey = locationKey
+	p.LastSeen = time.Now().Unix()
+	p.FromKey, p.ArrivesAt = "", 0
+
+	cameOnline := !p.online
+	p.online = true
+	p.Status = "online"
+	return *p, cameOnline
+}
+
+// Disconnect drops a connection. Returns the updated presence and whether the
+// pilot's last connection closed.
+func (t *PresenceTracker) Disconnect(pilotID string) (Presence, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.pilots[pilotID]
+	if !ok {
+		return Presence{}, false
+	}
+	p.connections--
+	p.LastSeen = time.Now().Unix()
+	if p.connections > 0 {
+		return *p, false
+	}
+	p.connections = 0
+	p.online = false
+	p.settle(p.LastSeen)
+	if p.Status != "in_transit" {
+		p.Status = "offline"
+	}
+	return *p, true
+}
+
+// Move updates a known pilot's location. Returns false for pilots that have
+// never connected (HTTP-only clients), which are not shown to others. Pilots
+// connected through another instance are known via Apply.
+func (t *PresenceTracker) Move(pilotID, locationKey string) (Presence, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.pilots[pilotID]
+	if !ok {
+		return Presence{}, false
+	}
+	p.LocationKey = locationKey
+	p.LastSeen = time.Now().Unix()
+	p.FromKey, p.ArrivesAt = "", 0
+	p.Status = "offline"
+	if p.online {
+		p.Status = "online"
+	}
+	return *p, true
+}
+
+// Depart shows a known pilot flying from one planet to another for distance
+// light years. Returns false for pilots that have never connected, as Move.
+func (t *PresenceTracker) Depart(pilotID, fromKey, destKey string, distance int64) (Presence, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.pilots[pilotID]
+	if !ok {
+		return Presence{}, false
+	}
+	now := time.Now().Unix()
+	p.Status = "in_transit"
+	p.FromKey = fromKey
+	p.LocationKey = destKey
+	p.ArrivesAt = now + distance*transitSecondsPerLY
+	p.LastSeen = now
+	return *p, true
+}
+
+// Apply records a presence event published by any instance (including this one).
+// An "offline" from elsewhere is ignored while the pilot still has connections here.
+func (t *PresenceTracker) Apply(update Presence) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.pilots[update.PilotID]
+	if !ok {
+		p = &Presence{PilotID: update.PilotID}
+		t.pilots[update.PilotID] = p
+	}
+	if update.Status == "offline" && p.connections > 0 {
+		return
+	}
+	p.ShipName = update.ShipName
+	p.Status = update.Status
+	p.LocationKey = update.LocationKey
+	p.FromKey = update.FromKey
+	p.ArrivesAt = update.ArrivesAt
+	p.LastSeen = update.LastSeen
+	if update.Status != "in_transit" {
+		p.online = update.Status == "online"
+	}
+}
+
+// List returns pilots sorted by ID, optionally filtered by location and status.
+// Pilots still in transit are not in port, so onlineOnly leaves them out.
+func (t *PresenceTracker) List(locationKey string, onlineOnly bool) []Presence {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now().Unix()
+	out := []Presence{}
+	for _, p := range t.pilots {
+		p.settle(now)
+		if locationKey != "" && p.LocationKey != locationKey {
+			continue
+		}
+		if onlineOnly && p.Status != "online" {
+			continue
+		}
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].PilotID < out[j].PilotID })
+	return out
+}
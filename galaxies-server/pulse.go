@@ -0,0 +1,72 @@
+/*
+Package main
+File: pulse.go
+Description: Computes per-planet job board diffs for the market_pulse broadcast.
+The last broadcast board is kept as a snapshot so each pulse only carries what
+changed: new contracts (full bodies), removed contract IDs and payout changes.
+*/
+
+package main
+
+// PriceChange reports a contract whose payout moved since the last pulse.
+type PriceChange struct {
+	ContractID string `json:"contract_id"`
+	OldPayout  int    `json:"old_payout"`
+	NewPayout  int    `json:"new_payout"`
+}
+
+// PlanetDiff is the change set for a single planet's job board.
+type PlanetDiff struct {
+	PlanetKey    string        `json:"planet_key"`
+	Added        []Contract    `json:"added"`
+	RemovedIDs   []string      `json:"removed_ids"`
+	PriceChanges []PriceChange `json:"price_changes"`
+}
+
+// lastBoards maps PlanetKey -> ContractID -> Payout as of the last pulse.
+// Only touched from the heartbeat goroutine.
+var lastBoards = make(map[string]map[string]int)
+
+// CollectMarketDiffs compares every board to the last snapshot, returns the
+// non-empty diffs and advances the snapshot.
+func CollectMarketDiffs() []PlanetDiff {
+	dataLock.RLock()
+	defer dataLock.RUnlock()
+
+	diffs := []PlanetDiff{}
+	for _, p := range CurrentUniverse.Planets {
+		prev := lastBoards[p.Key]
+		next := make(map[string]int)
+		diff := PlanetDiff{
+			PlanetKey:    p.Key,
+			Added:        []Contract{},
+			RemovedIDs:   []string{},
+			PriceChanges: []PriceChange{},
+		}
+
+		for _, c := range AvailableContracts[p.Key] {
+			next[c.ID] = c.Payout
+			oldPayout, existed := prev[c.ID]
+			if !existed {
+				diff.Added = append(diff.Added, c)
+			} else if oldPayout != c.Payout {
+				diff.PriceChanges = append(diff.PriceChanges, PriceChange{
+					ContractID: c.ID,
+					OldPayout:  oldPayout,
+					NewPayout:  c.Payout,
+				})
+			}
+		}
+		for id := range prev {
+			if _, still := next[id]; !still {
+				diff.RemovedIDs = append(diff.RemovedIDs, id)
+			}
+		}
+
+		lastBoards[p.Key] = next
+		if len(diff.Added)+len(diff.RemovedIDs)+len(diff.PriceChanges) > 0 {
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,156 @@
+/*
+Package main
+File: reputation.go
+Description: Factions and pilot standing. Factions from universe.yaml own sets of
+planets and issue the jobs posted there. A pilot's standing with a faction rises
+with deliveries and falls with dropped jobs, late deliveries and being caught
+smuggling. Standing tiers gate premium jobs and set prices at faction shipyards
+and fuel depots; it also counts in auctions.
+*/
+
+package main
+
+import "net/http"
+
+// Faction owns a set of planets.
+type Faction struct {
+	Key         string   `yaml:"key" json:"key"`
+	Name        string   `yaml:"name" json:"name"`
+	Description string   `yaml:"description" json:"description"`
+	Planets     []string `yaml:"planets" json:"planets"`
+}
+
+// StandingTier is a named band of standing with its price modifier.
+type StandingTier struct {
+	Name      string  `yaml:"name" json:"name"`
+	Min       int     `yaml:"min" json:"min"`               // Lowest standing in the tier
+	PriceMult float64 `yaml:"price_mult" json:"price_mult"` // Modules and fuel at the faction's planets
+}
+
+// ReputationConfig tunes standing from YAML.
+type ReputationConfig struct {
+	Min                 int            `yaml:"min" json:"min"`
+	Max                 int            `yaml:"max" json:"max"`
+	DeliveryGain        int            `yaml:"delivery_gain" json:"delivery_gain"`
+	DropPenalty         int            `yaml:"drop_penalty" json:"drop_penalty"`
+	LatePenalty         int            `yaml:"late_penalty" json:"late_penalty"`
+	LateRatio           float64        `yaml:"late_ratio" json:"late_ratio"` // Late = flown more than direct distance * this
+	SmugglingPenalty    int            `yaml:"smuggling_penalty" json:"smuggling_penalty"`
+	PremiumChance       float64        `yaml:"premium_chance" json:"premium_chance"` // Share of jobs reserved for trusted pilots
+	PremiumMult         float64        `yaml:"premium_mult" json:"premium_mult"`
+	PremiumMinStanding  int            `yaml:"premium_min_standing" json:"premium_min_standing"`
+	AuctionCreditsPerPt int            `yaml:"auction_credits_per_point" json:"auction_credits_per_point"` // Bid value of one standing point
+	Tiers               []StandingTier `yaml:"tiers" json:"tiers"`
+}
+
+// FactionStanding is one row of /api/reputation.
+type FactionStanding struct {
+	Faction  Faction      `json:"faction"`
+	Standing int          `json:"standing"`
+	Tier     StandingTier `json:"tier"`
+}
+
+// Reputation maps PilotID -> FactionKey -> standing. Guarded by dataLock.
+var Reputation = make(map[string]map[string]int)
+
+// factionOf returns the key of the faction owning a planet ("" if independent).
+func factionOf(planetKey string) string {
+	for _, f := range CurrentUniverse.Factions {
+		for _, p := range f.Planets {
+			if p == planetKey {
+				return f.Key
+			}
+		}
+	}
+	return ""
+}
+
+// standing is a pilot's standing with a faction (0 if unknown).
+func standing(pilotID, factionKey string) int {
+	return Reputation[pilotID][factionKey]
+}
+
+// adjustStanding moves a pilot's standing, clamped to the configured range.
+// Caller holds dataLock.
+func adjustStanding(pilotID, factionKey string, delta int) {
+	if factionKey == "" || delta == 0 {
+		return
+	}
+	cfg := CurrentUniverse.ReputationConfig
+	if Reputation[pilotID] == nil {
+		Reputation[pilotID] = make(map[string]int)
+	}
+	v := Reputation[pilotID][factionKey] + delta
+	if v < cfg.Min {
+		v = cfg.Min
+	}
+	if v > cfg.Max {
+		v = cfg.Max
+	}
+	Reputation[pilotID][factionKey] = v
+}
+
+// tierFor finds the highest tier a standing reaches.
+func tierFor(value int) StandingTier {
+	best := StandingTier{Name: "Neutral", PriceMult: 1.0}
+	found := false
+	for _, t := range CurrentUniverse.ReputationConfig.Tiers {
+		if value >= t.Min && (!found || t.Min > best.Min) {
+			best = t
+			found = true
+		}
+	}
+	if best.PriceMult == 0 {
+		best.PriceMult = 1.0
+	}
+	return best
+}
+
+// standingPriceMult scales shipyard and fuel prices at a planet for a pilot.
+func standingPriceMult(pilotID, planetKey string) float64 {
+	faction := factionOf(planetKey)
+	if faction == "" {
+		return 1.0
+	}
+	return tierFor(standing(pilotID, faction)).PriceMult
+}
+
+// tagFaction marks a generated job with its issuing faction and may reserve it
+// for trusted pilots at a premium.
+func tagFaction(c *Contract, roll float64) {
+	cfg := CurrentUniverse.ReputationConfig
+	c.Faction = factionOf(c.OriginKey)
+	if c.Faction != "" && roll < cfg.PremiumChance && cfg.PremiumMult > 0 {
+		c.Payout = int(float64(c.Payout) * cfg.PremiumMult)
+		c.MinStanding = cfg.PremiumMinStanding
+	}
+}
+
+// checkStanding refuses jobs the pilot isn't trusted with yet.
+func checkStanding(pilotID string, c Contract) error {
+	if c.MinStanding > 0 && standing(pilotID, c.Faction) < c.MinStanding {
+		return serviceError(http.StatusForbidden, "Faction standing too low for this contract")
+	}
+	return nil
+}
+
+// recordDeliveryStanding rewards a delivery, or penalises it if it arrived late.
+// Caller holds dataLock.
+func recordDeliveryStanding(pilotID string, c Contract) {
+	cfg := CurrentUniverse.ReputationConfig
+	if cfg.LateRatio > 0 && c.DirectDistance > 0 && float64(c.DistanceFlown) > float64(c.DirectDistance)*cfg.LateRatio {
+		adjustStanding(pilotID, c.Faction, -cfg.LatePenalty)
+		return
+	}
+	adjustStanding(pilotID, c.Faction, cfg.DeliveryGain)
+}
+
+// Standings lists every faction with the pilot's standing. Caller holds dataLock.
+func Standings(pilotID string) []FactionStanding {
+	out := []FactionStanding{}
+	for _, f := range CurrentUniverse.Factions {
+		v := standing(pilotID, f.Key)
+		out = append(out, FactionStanding{Faction: f, Standing: v, Tier: tierFor(v)})
+	}
+	return out
+}
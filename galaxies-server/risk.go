@@ -0,0 +1,242 @@
+/*
+Package main
+File: risk.go
+Description: Transit risk and cargo insurance. Every jump rolls for an incident,
+with odds growing with distance, lane hazard, hazardous cargo aboard, hull damage
+and galactic events at either end. An incident damages or destroys a job in the
+hold, delays the ship (the detour counts against passengers, perishables and
+lateness) or drains fuel. Pilots can insure a voyage before departing; the policy
+reimburses cargo lost on the next jump, whether to incidents or to special handling.
+
+Each voyage draws from its own RNG, seeded from transit_risk.seed, the pilot, the
+ship and its voyage count, so a fixed seed replays the same outcomes.
+*/
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Transit incident kinds
+const (
+	IncidentDamage    = "damage"
+	IncidentDestroyed = "destroyed"
+	IncidentDelay     = "delay"
+	IncidentFuelLeak  = "fuel_leak"
+)
+
+// RiskConfig tunes transit incidents and insurance from YAML.
+type RiskConfig struct {
+	Seed                int64          `yaml:"seed" json:"-"`                                      // 0 = random per server start
+	ChancePerLY         float64        `yaml:"chance_per_ly" json:"chance_per_ly"`                 // Base incident odds per LY
+	HazardMult          float64        `yaml:"hazard_mult" json:"hazard_mult"`                     // Odds * (1 + this * lane hazard)
+	HazardousCargoMult  float64        `yaml:"hazardous_cargo_mult" json:"hazardous_cargo_mult"`   // Odds * (1 + this per hazardous job aboard)
+	MaxChance           float64        `yaml:"max_chance" json:"max_chance"`                       // Cap per jump
+	Weights             map[string]int `yaml:"weights" json:"weights"`                             // Relative odds of each incident kind
+	DamageLoss          int            `yaml:"damage_loss" json:"damage_loss"`                     // % of a job's payout lost to damage
+	DelayRatio          float64        `yaml:"delay_ratio" json:"delay_ratio"`                     // Extra LY drifted = jump distance * this
+	FuelLeak            int            `yaml:"fuel_leak" json:"fuel_leak"`                         // % of remaining fuel lost
+	InsurancePremium    float64        `yaml:"insurance_premium" json:"insurance_premium"`         // Premium = insured value * this
+	InsuranceMinPremium int            `yaml:"insurance_min_premium" json:"insurance_min_premium"` // Floor on the premium
+	InsuranceCoverage   float64        `yaml:"insurance_coverage" json:"insurance_coverage"`       // Share of losses reimbursed
+}
+
+// TransitIncident is something that went wrong on a jump.
+type TransitIncident struct {
+	Kind       string `json:"kind"`
+	ContractID string `json:"contract_id,omitempty"`
+	Loss       int    `json:"loss,omitempty"`      // Credits knocked off (or lost with) the job
+	FuelLost   int64  `json:"fuel_lost,omitempty"` // Fuel drained
+	DelayLY    int64  `json:"delay_ly,omitempty"`  // Extra distance drifted
+	Text       string `json:"text"`
+}
+
+// InsurancePolicy covers the ship's next jump.
+type InsurancePolicy struct {
+	InsuredValue int     `json:"insured_value"` // Most the policy pays out
+	Premium      int     `json:"premium"`
+	Coverage     float64 `json:"coverage"`
+}
+
+// riskSeed is the base seed for voyage RNGs, set by InitRisk.
+var riskSeed int64
+
+// InitRisk fixes the base seed from YAML, or picks one if unset.
+func InitRisk() {
+	riskSeed = CurrentUniverse.RiskConfig.Seed
+	if riskSeed == 0 {
+		riskSeed = time.Now().UnixNano()
+	}
+}
+
+// voyageRand is the RNG for a ship's next jump.
+func voyageRand(ship *Ship) *rand.Rand {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%s/%d", ship.PilotID, ship.ShipID, ship.Voyages)
+	return rand.New(rand.NewSource(riskSeed ^ int64(h.Sum64())))
+}
+
+// EventRiskMult applies to incident odds on a jump between two planets.
+func EventRiskMult(originKey, destKey string) float64 {
+	pick := func(fx EventEffects) float64 { return fx.RiskMult }
+	return eventMult(originKey, pick) * eventMult(destKey, pick)
+}
+
+// incidentOdds is the chance of a transit incident on a jump.
+func incidentOdds(ship *Ship, origin, dest *Planet, dist int64) float64 {
+	cfg := CurrentUniverse.RiskConfig
+	odds := cfg.ChancePerLY * float64(dist)
+	odds *= 1 + cfg.HazardMult*laneHazard(origin, dest)
+	for _, c := range ship.ActiveContracts {
+		if c.HasFlag(FlagHazardous) {
+			odds *= 1 + cfg.HazardousCargoMult
+		}
+	}
+	odds *= EventRiskMult(origin.Key, dest.Key) * hullRiskMult(ship)
+	if cfg.MaxChance > 0 && odds > cfg.MaxChance {
+		odds = cfg.MaxChance
+	}
+	return odds
+}
+
+// rollTransit rolls for an incident on a jump of dist LY and applies it. Damage
+// and destruction hit one cargo job; destroyed jobs leave the hold. Returns the
+// incidents and any extra distance drifted. Caller holds dataLock.
+func rollTransit(ship *Ship, origin, dest *Planet, dist int64, rng *rand.Rand) ([]TransitIncident, int64) {
+	cfg := CurrentUniverse.RiskConfig
+	if rng.Float64() >= incidentOdds(ship, origin, dest, dist) {
+		return nil, 0
+	}
+
+	// 1. Pick a kind; cargo incidents need cargo aboard
+	cargo := []int{}
+	for i, c := range ship.ActiveContracts {
+		if c.Type == "cargo" {
+			cargo = append(cargo, i)
+		}
+	}
+	kinds := []string{IncidentDamage, IncidentDestroyed, IncidentDelay, IncidentFuelLeak}
+	total := 0
+	for _, k := range kinds {
+		if (k == IncidentDamage || k == IncidentDestroyed) && len(cargo) == 0 {
+			continue
+		}
+		total += cfg.Weights[k]
+	}
+	if total <= 0 {
+		return nil, 0
+	}
+	kind := ""
+	roll := rng.Intn(total)
+	for _, k := range kinds {
+		if (k == IncidentDamage || k == IncidentDestroyed) && len(cargo) == 0 {
+			continue
+		}
+		if roll < cfg.Weights[k] {
+			kind = k
+			break
+		}
+		roll -= cfg.Weights[k]
+	}
+
+	// 2. Apply it
+	inc := TransitIncident{Kind: kind}
+	var delay int64
+	switch kind {
+	case IncidentDamage:
+		c := &ship.ActiveContracts[cargo[rng.Intn(len(cargo))]]
+		inc.ContractID = c.ID
+		inc.Loss = int(float64(c.Payout*cfg.DamageLoss) / 100 * crewReduction(ship, RoleEngineer))
+		c.Payout -= inc.Loss
+		inc.Text = fmt.Sprintf("Micrometeorite strike. The %s took damage.", c.ItemName)
+	case IncidentDestroyed:
+		i := cargo[rng.Intn(len(cargo))]
+		c := ship.ActiveContracts[i]
+		ship.ActiveContracts = append(ship.ActiveContracts[:i], ship.ActiveContracts[i+1:]...)
+		inc.ContractID = c.ID
+		inc.Loss = c.Payout
+		inc.Text = fmt.Sprintf("Hull breach in the hold. The %s was lost to space.", c.ItemName)
+		if c.PostedBy != "" {
+			refundEscrow(c)
+		}
+		if c.MissionID != "" {
+			AbandonMission(ship, c.MissionID)
+		}
+	case IncidentDelay:
+		delay = int64(float64(dist) * cfg.DelayRatio)
+		inc.DelayLY = delay
+		inc.Text = fmt.Sprintf("Nav fault. The ship drifted %d LY off course before correcting.", delay)
+	case IncidentFuelLeak:
+		inc.FuelLost = ship.Fuel * int64(cfg.FuelLeak) / 100
+		ship.Fuel -= inc.FuelLost
+		inc.Text = fmt.Sprintf("Fuel line rupture. %d fuel vented.", inc.FuelLost)
+	}
+	return []TransitIncident{inc}, delay
+}
+
+// insuredValue is what a policy bought now would cover: the hold's payouts.
+func insuredValue(ship *Ship) int {
+	value := 0
+	for _, c := range ship.ActiveContracts {
+		value += c.Payout
+	}
+	return value
+}
+
+// QuoteInsurance prices a policy for the ship's next jump.
+func QuoteInsurance(ship *Ship) (InsurancePolicy, error) {
+	cfg := CurrentUniverse.RiskConfig
+	value := insuredValue(ship)
+	if value <= 0 {
+		return InsurancePolicy{}, serviceError(http.StatusBadRequest, "Nothing aboard to insure")
+	}
+	premium := int(float64(value) * cfg.InsurancePremium)
+	if premium < cfg.InsuranceMinPremium {
+		premium = cfg.InsuranceMinPremium
+	}
+	return InsurancePolicy{InsuredValue: value, Premium: premium, Coverage: cfg.InsuranceCoverage}, nil
+}
+
+// BuyInsurance insures the ship's next jump. Caller holds dataLock.
+func BuyInsurance(ship *Ship) (InsurancePolicy, error) {
+	if ship.Insurance != nil {
+		return InsurancePolicy{}, serviceError(http.StatusConflict, "Voyage already insured")
+	}
+	policy, err := QuoteInsurance(ship)
+	if err != nil {
+		return InsurancePolicy{}, err
+	}
+	if ship.Credits < policy.Premium {
+		return InsurancePolicy{}, serviceError(http.StatusPaymentRequired, "Insufficient credits")
+	}
+	moveCredits(ship, -policy.Premium, LedgerEntry{Reason: "insurance_premium"})
+	ship.Insurance = &policy
+	return policy, nil
+}
+
+// settleInsurance pays the claim for a jump's cargo losses and ends the policy.
+// Returns the claim. Caller holds dataLock.
+func settleInsurance(ship *Ship, result *TravelResult) int {
+	policy := ship.Insurance
+	ship.Insurance = nil
+	if policy == nil {
+		return 0
+	}
+	loss := 0
+	for _, inc := range result.Incidents {
+		loss += inc.Loss
+	}
+	for _, inc := range result.Transit {
+		loss += inc.Loss
+	}
+	claim := int(float64(loss) * policy.Coverage)
+	if claim > policy.InsuredValue {
+		claim = policy.InsuredValue
+	}
+	return claim
+}
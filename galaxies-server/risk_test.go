@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testVoyageShip is a ship at planet_prime carrying one job for every kind of
+// roll: hazardous and perishable cargo for handling, and goods banned at the
+// destination for customs.
+func testVoyageShip(voyages int) *Ship {
+	ship := newShip("test-pilot")
+	ship.ShipID = "SHIP-test"
+	ship.Voyages = voyages
+	ship.CargoCapacity = 1000
+	ship.ActiveContracts = []Contract{
+		{ID: "CRG-haz", Type: "cargo", ItemName: "Plasma", ItemKey: "test_plasma", Quantity: 5, OriginKey: "planet_prime", DestinationKey: "planet_forge", Payout: 1000, Flags: []string{FlagHazardous}},
+		{ID: "CRG-food", Type: "cargo", ItemName: "Fish", ItemKey: "test_fish", Quantity: 5, OriginKey: "planet_prime", DestinationKey: "planet_forge", Payout: 1000, Flags: []string{FlagPerishable}},
+		{ID: "CRG-smuggled", Type: "cargo", ItemName: "Spice", ItemKey: "test_spice", Quantity: 5, OriginKey: "planet_prime", DestinationKey: "planet_forge", Payout: 1000},
+	}
+	return ship
+}
+
+// TestVoyageDeterministic flies the same ship state twice per voyage number and
+// expects identical transit, handling and customs outcomes.
+func TestVoyageDeterministic(t *testing.T) {
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	history, _ := NewChatHistory("")
+	hub, err := NewHub(history, NewMemoryBroker())
+	if err != nil {
+		t.Fatalf("NewHub: %v", err)
+	}
+	go hub.Run()
+	gameHub = hub
+
+	// Odds high enough that every roll goes both ways across the voyages
+	riskSeed = 42
+	CurrentUniverse.RiskConfig.ChancePerLY = 0.05
+	CurrentUniverse.RiskConfig.MaxChance = 0.6
+	CurrentUniverse.HandlingConfig.IncidentChancePerLY = 0.05
+	for i := range CurrentUniverse.Planets {
+		if p := &CurrentUniverse.Planets[i]; p.Key == "planet_forge" {
+			p.Security = 0.5
+			p.Banned = append(p.Banned, "test_spice")
+		}
+	}
+
+	searched, incidents := 0, 0
+	for v := 0; v < 40; v++ {
+		a, b := testVoyageShip(v), testVoyageShip(v)
+		ra := arrive(a, "planet_forge", TravelQuote{Distance: 10})
+		rb := arrive(b, "planet_forge", TravelQuote{Distance: 10})
+
+		if !reflect.DeepEqual(ra.Transit, rb.Transit) {
+			t.Errorf("voyage %d: transit %+v != %+v", v, ra.Transit, rb.Transit)
+		}
+		if !reflect.DeepEqual(ra.Incidents, rb.Incidents) {
+			t.Errorf("voyage %d: handling %+v != %+v", v, ra.Incidents, rb.Incidents)
+		}
+		if !reflect.DeepEqual(ra.Customs, rb.Customs) {
+			t.Errorf("voyage %d: customs %+v != %+v", v, ra.Customs, rb.Customs)
+		}
+		if ra.Customs != nil {
+			searched++
+		}
+		incidents += len(ra.Transit) + len(ra.Incidents)
+	}
+	if searched == 0 || searched == 40 || incidents == 0 {
+		t.Fatalf("rolls never varied (searched %d of 40, %d incidents); the test proves nothing", searched, incidents)
+	}
+}
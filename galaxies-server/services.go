@@ -0,0 +1,300 @@
+/*
+Package main
+File: services.go
+Description: Game rules for accepting contracts, travelling and refuelling, shared
+by the HTTP handlers and the NPC traders. Services mutate state and return the
+outcome; notifying clients is left to the caller. Every service expects the caller
+to hold dataLock.
+*/
+
+package main
+
+import (
+	"net/http"
+)
+
+// ServiceError is a rule violation, carrying the HTTP status handlers should answer with.
+type ServiceError struct {
+	Status  int
+	Message string
+}
+
+func (e *ServiceError) Error() string { return e.Message }
+
+func serviceError(status int, msg string) *ServiceError {
+	return &ServiceError{Status: status, Message: msg}
+}
+
+// writeServiceError answers a request with a ServiceError (or a 500 for anything else).
+func writeServiceError(w http.ResponseWriter, err error) {
+	if se, ok := err.(*ServiceError); ok {
+		http.Error(w, se.Message, se.Status)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// shipLoad counts cargo units and passengers aboard.
+func shipLoad(ship *Ship) (cargo, passengers int) {
+	for _, ac := range ship.ActiveContracts {
+		if ac.Type == "cargo" {
+			cargo += ac.Quantity
+		} else {
+			passengers += ac.Quantity
+		}
+	}
+	return cargo, passengers
+}
+
+// canCarry checks capacity, comfort and special-handling equipment for a contract.
+func canCarry(ship *Ship, c Contract) error {
+	cargo, passengers := shipLoad(ship)
+	if c.Type == "cargo" && cargo+c.Quantity > ship.CargoCapacity {
+		return serviceError(http.StatusConflict, "Insufficient Cargo Space")
+	}
+	if c.Type == "passenger" && passengers+len(ship.Crew)+c.Quantity > ship.PassengerSlots {
+		return serviceError(http.StatusConflict, "Insufficient Passenger Slots")
+	}
+	if c.Type == "passenger" && ship.Comfort < c.ComfortRequired {
+		return serviceError(http.StatusConflict, "Cabins do not meet passenger comfort requirement")
+	}
+	return canHandle(ship, c)
+}
+
+// AcceptContract moves a contract from the local board to the ship and triggers Market Scarcity.
+func AcceptContract(ship *Ship, contractID string) (Contract, error) {
+	board := AvailableContracts[ship.LocationKey]
+	foundIdx := -1
+	for i, c := range board {
+		if c.ID == contractID {
+			foundIdx = i
+			break
+		}
+	}
+	if foundIdx == -1 {
+		return Contract{}, serviceError(http.StatusNotFound, "Contract not found")
+	}
+
+	target := board[foundIdx]
+	if target.PostedBy != "" && target.PostedBy == ship.PilotID {
+		return Contract{}, serviceError(http.StatusConflict, "Cannot accept your own contract")
+	}
+	if target.PostedBy != "" && target.CorpID == "" && sameOrigin(target.PostedBy, ship.PilotID) {
+		return Contract{}, serviceError(http.StatusForbidden, "Cannot accept contracts posted from your connection")
+	}
+	if err := checkStanding(ship.PilotID, target); err != nil {
+		return Contract{}, err
+	}
+	if err := canCarry(ship, target); err != nil {
+		return Contract{}, err
+	}
+
+	// 1. Add to Ship
+	ship.ActiveContracts = append(ship.ActiveContracts, target)
+
+	// 2. Remove from Board
+	AvailableContracts[ship.LocationKey] = append(board[:foundIdx], board[foundIdx+1:]...)
+
+	// 3. MARKET EVENT: Record Acceptance (Increase Scarcity at Origin)
+	// Player-posted goods are private and don't move the market.
+	if target.PostedBy == "" {
+		Market.RecordAcceptance(target.OriginKey, target.ItemKey, target.Quantity)
+	}
+
+	return target, nil
+}
+
+// TravelQuote is the cost of a jump at the ship's current mass.
+type TravelQuote struct {
+	Distance int64
+	FuelCost int64
+	BurnRate int64
+	Risk     float64 // Odds of a transit incident (see risk.go)
+}
+
+// QuoteTravel prices a jump from the ship's location to a destination.
+func QuoteTravel(ship *Ship, destKey string) (TravelQuote, error) {
+	dest := GetPlanet(destKey)
+	current := GetPlanet(ship.LocationKey)
+	if dest == nil {
+		return TravelQuote{}, serviceError(http.StatusNotFound, "Destination invalid")
+	}
+	if current == nil {
+		// The planet was removed by a config reload; only a tow gets the ship out
+		return TravelQuote{}, serviceError(http.StatusConflict, "Current location no longer exists")
+	}
+	if dest.Key == current.Key {
+		return TravelQuote{}, serviceError(http.StatusBadRequest, "Already docked there")
+	}
+
+	dist := CalculateDistance(current.Coordinates, dest.Coordinates)
+	currentBurn := CalculateCurrentBurn(ship)
+	fuelNeeded := int64(float64(dist*currentBurn) * EventTravelCostMult(current.Key, dest.Key))
+
+	return TravelQuote{
+		Distance: dist,
+		FuelCost: fuelNeeded,
+		BurnRate: currentBurn,
+		Risk:     incidentOdds(ship, current, dest, dist),
+	}, nil
+}
+
+// TravelResult is what happened on arrival.
+type TravelResult struct {
+	Quote     TravelQuote
+	Origin    string            // Planet the jump left from
+	Delivered []Contract        // Contracts completed at the destination (passenger payouts are final fares)
+	Missions  []MissionProgress // Mission legs closed or loaded here
+	Incidents []CargoIncident   // Value lost in transit by special-handling cargo
+	Transit   []TransitIncident // Accidents on the jump (see risk.go)
+	Claim     int               // Insurance paid for this jump's losses (included in Payout)
+	Customs   *CustomsReport    // Set if the ship was searched and caught
+	Payout    int               // Credits earned, including mission bonuses
+	Garnished int               // Part of Payout taken by the bank for a defaulted loan
+}
+
+// TravelShip jumps the ship to a destination and delivers everything bound there,
+// triggering Market Saturation.
+func TravelShip(ship *Ship, destKey string) (TravelResult, error) {
+	quote, err := QuoteTravel(ship, destKey)
+	if err != nil {
+		return TravelResult{}, err
+	}
+	if ship.Fuel < quote.FuelCost {
+		return TravelResult{}, serviceError(http.StatusPaymentRequired, "Insufficient Fuel for current mass")
+	}
+
+	ship.Fuel -= quote.FuelCost
+	return arrive(ship, destKey, quote), nil
+}
+
+// arrive moves the ship along a lane and runs everything that happens on
+// arrival: transit incidents, customs, cargo handling, deliveries, missions
+// and payment.
+func arrive(ship *Ship, destKey string, quote TravelQuote) TravelResult {
+	origin, dest := GetPlanet(ship.LocationKey), GetPlanet(destKey)
+	if origin == nil {
+		origin = dest // Towed off a planet removed by a reload
+	}
+	hazard := laneHazard(origin, dest)
+	rng := voyageRand(ship)
+	ship.Voyages++
+
+	// Accidents en route; a delay adds to the distance every job has flown
+	result := TravelResult{Quote: quote, Origin: origin.Key}
+	transit, delay := rollTransit(ship, origin, dest, quote.Distance, rng)
+	result.Transit = transit
+	flown := quote.Distance + delay
+	wearShip(ship, flown, hazard)
+	ship.LocationKey = destKey
+
+	// Customs search before anything is unloaded
+	result.Customs = runCustoms(ship, dest, rng)
+
+	// Handle automatic delivery upon arrival
+	remainingContracts := []Contract{}
+
+	for _, c := range ship.ActiveContracts {
+		c.DistanceFlown += flown
+		result.Incidents = append(result.Incidents, applyHandling(ship, &c, flown, hazard, rng)...)
+		if c.Type == "passenger" {
+			c.Satisfaction = passengerSatisfaction(c, ship)
+		}
+
+		if c.DestinationKey == ship.LocationKey {
+			if c.Type == "passenger" {
+				c.Payout = passengerFare(c)
+			}
+			if c.PostedBy != "" && c.Payout > c.Escrow {
+				c.Payout = c.Escrow // Postings pay no more than the poster put up
+			}
+			result.Payout += c.Payout
+			result.Delivered = append(result.Delivered, c)
+			recordDeliveryStanding(ship.PilotID, c)
+
+			if c.PostedBy != "" {
+				releaseEscrow(c, c.Escrow-c.Payout)
+				continue
+			}
+			if c.MissionID != "" {
+				continue // Scripted cargo, settled by advanceMissions
+			}
+
+			// MARKET EVENT: Record Delivery (Increase Saturation at Destination)
+			Market.RecordDelivery(c.DestinationKey, c.ItemKey, c.Quantity)
+			if c.Type == "cargo" {
+				AddStock(c.DestinationKey, c.ItemKey, c.Quantity)
+			}
+
+		} else {
+			remainingContracts = append(remainingContracts, c)
+		}
+	}
+	ship.ActiveContracts = remainingContracts
+
+	// Close delivered mission legs and load any waiting here
+	advanceMissions(ship, &result)
+
+	// Insurance covers this jump's cargo losses
+	result.Claim = settleInsurance(ship, &result)
+	result.Payout += result.Claim
+
+	// Pilots in default have part of every payout seized by the bank
+	result.Garnished = garnish(ship.PilotID, result.Payout)
+
+	// Pay out, one ledger entry per source
+	for _, c := range result.Delivered {
+		moveCredits(ship, c.Payout, LedgerEntry{Reason: "delivery", ContractID: c.ID, MissionID: c.MissionID})
+	}
+	for _, m := range result.Missions {
+		if m.Event == "completed" {
+			moveCredits(ship, m.Mission.CompletionBonus, LedgerEntry{Reason: "mission_bonus", MissionID: m.Mission.ID})
+		}
+	}
+	moveCredits(ship, result.Claim, LedgerEntry{Reason: "insurance_claim"})
+	moveCredits(ship, -result.Garnished, LedgerEntry{Reason: "garnished"})
+
+	return result
+}
+
+// applyModuleStats adds (sign 1) or removes (sign -1) a module's stat bonus.
+func applyModuleStats(ship *Ship, mod ShipModule, sign int) {
+	v := mod.StatValue * sign
+	switch mod.StatModifier {
+	case "cargo_capacity":
+		ship.CargoCapacity += v
+	case "passenger_slots":
+		ship.PassengerSlots += v
+	case "comfort":
+		ship.Comfort += v
+	case "containment":
+		ship.Containment += v
+	case "refrigeration":
+		ship.Refrigeration += v
+	case "concealment":
+		ship.Concealment += v
+	}
+}
+
+// refuelCost prices filling the tank at the ship's location.
+func refuelCost(ship *Ship) int {
+	cost := (int(ship.MaxFuel-ship.Fuel) / 100) * CurrentUniverse.BalanceConfig.FuelCostPerUnit
+	return int(float64(cost) * EventFuelPriceMult(ship.LocationKey) * standingPriceMult(ship.PilotID, ship.LocationKey))
+}
+
+// RefuelShip fills the tank at local prices and returns the credits spent.
+func RefuelShip(ship *Ship) (int, error) {
+	fuelNeeded := ship.MaxFuel - ship.Fuel
+	if fuelNeeded <= 0 {
+		return 0, serviceError(http.StatusBadRequest, "Tank is already full")
+	}
+
+	cost := refuelCost(ship)
+	if ship.Credits < cost {
+		return 0, serviceError(http.StatusForbidden, "Insufficient credits")
+	}
+
+	moveCredits(ship, -cost, LedgerEntry{Reason: "refuel"})
+	ship.Fuel = ship.MaxFuel
+	return cost, nil
+}
@@ -0,0 +1,245 @@
+/*
+Package main
+File: sessions.go
+Description: Pilot sessions. A client opens a session once (POST /api/session) and
+gets back a pilot ID and a random token bound to it. Pilot endpoints and the
+WebSocket identify the caller by that token alone, and a pilot ID can only be
+claimed by the first session that asks for it, so knowing someone's ID is not
+enough to fly their ship or spend their credits.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Session binds a token to a pilot.
+type Session struct {
+	Token     string `json:"token"`
+	PilotID   string `json:"pilot_id"`
+	Origin    string `json:"-"` // Host that opened it
+	CreatedAt int64  `json:"created_at"`
+}
+
+// SessionRequest opens a session, optionally claiming a pilot ID.
+type SessionRequest struct {
+	PilotID string `json:"pilot_id"` // Empty = the server picks one
+}
+
+// SessionStore is safe for concurrent use by the hub and HTTP handlers.
+type SessionStore struct {
+	mu      sync.RWMutex
+	byToken map[string]*Session
+	byPilot map[string]*Session
+}
+
+func NewSessionStore() *SessionStore {
+	return &SessionStore{
+		byToken: make(map[string]*Session),
+		byPilot: make(map[string]*Session),
+	}
+}
+
+// sessions holds every open session. Only the primary issues or checks them.
+var sessions = NewSessionStore()
+
+// pilotKey is the request context key for the authenticated pilot.
+type pilotKey struct{}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // The OS RNG failing is not something we can play on through
+	}
+	return hex.EncodeToString(b)
+}
+
+// validPilotID keeps claimed IDs short and safe to echo into URLs and logs, and
+// off the NPC traders' "npc-" names.
+func validPilotID(id string) bool {
+	if len(id) == 0 || len(id) > 32 || strings.HasPrefix(strings.ToLower(id), "npc-") {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// Open claims a pilot ID (or picks a fresh one) and issues its token.
+func (s *SessionStore) Open(pilotID, origin string) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pilotID == "" {
+		for pilotID == "" || s.byPilot[pilotID] != nil {
+			pilotID = "PLT-" + randomHex(4)
+		}
+	} else if !validPilotID(pilotID) {
+		return Session{}, serviceError(http.StatusBadRequest, "Pilot ID must be 1-32 letters, digits, '-' or '_', not starting with npc-")
+	} else if s.byPilot[pilotID] != nil {
+		return Session{}, serviceError(http.StatusConflict, "Pilot already claimed")
+	}
+
+	sess := &Session{
+		Token:     randomHex(32),
+		PilotID:   pilotID,
+		Origin:    origin,
+		CreatedAt: time.Now().Unix(),
+	}
+	s.byToken[sess.Token] = sess
+	s.byPilot[pilotID] = sess
+	return *sess, nil
+}
+
+// Lookup finds the session for a token.
+func (s *SessionStore) Lookup(token string) (Session, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sess, ok := s.byToken[token]
+	if !ok {
+		return Session{}, false
+	}
+	return *sess, true
+}
+
+// ForPilot finds the session that claimed a pilot.
+func (s *SessionStore) ForPilot(pilotID string) (Session, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sess, ok := s.byPilot[pilotID]
+	if !ok {
+		return Session{}, false
+	}
+	return *sess, true
+}
+
+// sessionToken reads the token from "Authorization: Bearer", X-Session-Token,
+// or ?token= (browsers can't set headers on a WebSocket).
+func sessionToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if token := r.Header.Get("X-Session-Token"); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("token")
+}
+
+// trustedProxies are the replicas and proxies (GALAXIES_TRUSTED_PROXIES) whose
+// X-Forwarded-For we believe. Set once in main.
+var trustedProxies []*net.IPNet
+
+// parseTrustedProxies reads a comma-separated list of IPs and CIDRs.
+func parseTrustedProxies(list string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// clientHost is the caller's address. Behind a trusted replica or proxy it's
+// the hop that proxy appended to X-Forwarded-For; anyone else's header is
+// ignored, since a client can put whatever it likes there.
+func clientHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	fwd := r.Header.Get("X-Forwarded-For")
+	if fwd == "" || !isTrustedProxy(host) {
+		return host
+	}
+	hops := strings.Split(fwd, ",")
+	return strings.TrimSpace(hops[len(hops)-1])
+}
+
+// isTrustedProxy reports whether host is in trustedProxies.
+func isTrustedProxy(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// requireSession rejects requests without a valid token and records the pilot
+// for pilotID.
+func requireSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := sessions.Lookup(sessionToken(r))
+		if !ok {
+			http.Error(w, "Session required", http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), pilotKey{}, sess.PilotID)))
+	}
+}
+
+// pilotID is the authenticated caller. Only valid behind requireSession.
+func pilotID(r *http.Request) string {
+	id, _ := r.Context().Value(pilotKey{}).(string)
+	return id
+}
+
+// handleOpenSession issues a token for a new (or unclaimed) pilot and
+// commissions their ship.
+func handleOpenSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req SessionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	sess, err := sessions.Open(req.PilotID, clientHost(r))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	dataLock.Lock()
+	GetPilotShip(sess.PilotID)
+	dataLock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sess)
+}
@@ -28,6 +28,120 @@ type GameBalance struct {
 	DistancePayoutMult int `yaml:"distance_payout_mult" json:"distance_payout_mult"`
 }
 
+// MarketModel tunes the heat economy from YAML. Zero values fall back to the
+// original hard-coded behaviour (see withDefaults).
+type MarketModel struct {
+	AcceptanceImpact float64 `yaml:"acceptance_impact" json:"acceptance_impact"` // Source heat per unit accepted
+	DeliveryImpact   float64 `yaml:"delivery_impact" json:"delivery_impact"`     // Dest heat per unit delivered
+	RecoveryMode     string  `yaml:"recovery_mode" json:"recovery_mode"`         // "linear" or "exponential"
+	RecoveryRate     float64 `yaml:"recovery_rate" json:"recovery_rate"`         // Linear: heat per tick. Exponential: fraction of the gap per tick
+	MinHeat          float64 `yaml:"min_heat" json:"min_heat"`                   // Floor
+	MaxHeat          float64 `yaml:"max_heat" json:"max_heat"`                   // Ceiling
+
+	// Planet stockpiles (see economy.go)
+	ProductionRate  int `yaml:"production_rate" json:"production_rate"`   // Units per heartbeat of each produced good
+	ConsumptionRate int `yaml:"consumption_rate" json:"consumption_rate"` // Units per heartbeat of each demanded good
+	StockpileCap    int `yaml:"stockpile_cap" json:"stockpile_cap"`       // Warehouse limit per commodity
+	StartingStock   int `yaml:"starting_stock" json:"starting_stock"`     // Initial stock of produced goods
+
+	// Destination selection for cargo (see pickCargoDestination)
+	DemandWeight       float64 `yaml:"demand_weight" json:"demand_weight"`                             // Odds vs. a neutral planet of picking one that demands the good
+	DemandPremium      float64 `yaml:"demand_premium" json:"demand_premium"`                           // Payout multiplier for demanded goods
+	AllowProducerDests bool    `yaml:"allow_producer_destinations" json:"allow_producer_destinations"` // Ship goods to planets that make them?
+	ProducerPayoutMult float64 `yaml:"producer_payout_mult" json:"producer_payout_mult"`               // Payout multiplier when allowed
+
+	CommodityOverrides map[string]CommodityHeatOverride `yaml:"commodity_overrides" json:"commodity_overrides"`
+}
+
+// CommodityHeatOverride replaces the global factors for one commodity. Zero = inherit.
+type CommodityHeatOverride struct {
+	AcceptanceImpact float64 `yaml:"acceptance_impact" json:"acceptance_impact"`
+	DeliveryImpact   float64 `yaml:"delivery_impact" json:"delivery_impact"`
+	RecoveryRate     float64 `yaml:"recovery_rate" json:"recovery_rate"`
+}
+
+// withDefaults fills unset fields with the pre-YAML constants.
+func (m MarketModel) withDefaults() MarketModel {
+	if m.AcceptanceImpact == 0 {
+		m.AcceptanceImpact = 0.01
+	}
+	if m.DeliveryImpact == 0 {
+		m.DeliveryImpact = 0.02
+	}
+	if m.RecoveryMode == "" {
+		m.RecoveryMode = "linear"
+	}
+	if m.RecoveryRate == 0 {
+		m.RecoveryRate = 0.05
+	}
+	if m.MinHeat == 0 {
+		m.MinHeat = 0.1
+	}
+	if m.MaxHeat == 0 {
+		m.MaxHeat = 10.0
+	}
+	if m.ProductionRate == 0 {
+		m.ProductionRate = 30
+	}
+	if m.ConsumptionRate == 0 {
+		m.ConsumptionRate = 15
+	}
+	if m.StockpileCap == 0 {
+		m.StockpileCap = 600
+	}
+	if m.StartingStock == 0 {
+		m.StartingStock = 200
+	}
+	if m.DemandWeight == 0 {
+		m.DemandWeight = 4.0
+	}
+	if m.DemandPremium == 0 {
+		m.DemandPremium = 1.3
+	}
+	if m.ProducerPayoutMult == 0 {
+		m.ProducerPayoutMult = 0.5
+	}
+	return m
+}
+
+func (m MarketModel) acceptanceImpact(itemKey string) float64 {
+	if o, ok := m.CommodityOverrides[itemKey]; ok && o.AcceptanceImpact != 0 {
+		return o.AcceptanceImpact
+	}
+	return m.AcceptanceImpact
+}
+
+func (m MarketModel) deliveryImpact(itemKey string) float64 {
+	if o, ok := m.CommodityOverrides[itemKey]; ok && o.DeliveryImpact != 0 {
+		return o.DeliveryImpact
+	}
+	return m.DeliveryImpact
+}
+
+func (m MarketModel) recoveryRate(itemKey string) float64 {
+	if o, ok := m.CommodityOverrides[itemKey]; ok && o.RecoveryRate != 0 {
+		return o.RecoveryRate
+	}
+	return m.RecoveryRate
+}
+
+// clamp keeps heat inside the configured floor and ceiling.
+func (m MarketModel) clamp(heat float64) float64 {
+	return math.Min(m.MaxHeat, math.Max(m.MinHeat, heat))
+}
+
+// recover moves heat one tick back towards the neutral 1.0.
+func (m MarketModel) recover(itemKey string, heat float64) float64 {
+	rate := m.recoveryRate(itemKey)
+	if m.RecoveryMode == "exponential" {
+		return m.clamp(1.0 + (heat-1.0)*(1.0-rate))
+	}
+	if heat > 1.0 {
+		return math.Max(1.0, heat-rate)
+	}
+	return math.Min(1.0, heat+rate)
+}
+
 type ShipModule struct {
 	Key          string `yaml:"key" json:"key"`
 	Name         string `yaml:"name" json:"name"`
@@ -35,6 +149,7 @@ type ShipModule struct {
 	Cost         int    `yaml:"cost" json:"cost"`
 	StatModifier string `yaml:"stat_modifier" json:"stat_modifier"`
 	StatValue    int    `yaml:"stat_value" json:"stat_value"`
+	CorpID       string `yaml:"-" json:"corp_id,omitempty"` // Installed with this corp's treasury; not the pilot's collateral
 }
 
 type Contract struct {
@@ -47,6 +162,34 @@ type Contract struct {
 	OriginKey      string `json:"origin_key"`
 	DestinationKey string `json:"destination_key"`
 	Payout         int    `json:"payout"`
+
+	// Galactic event multiplier baked into Payout; 0 for jobs events don't reprice
+	eventMult float64
+
+	// Travel tracking (updated on every jump while aboard)
+	DistanceFlown  int64 `json:"distance_flown"`
+	DirectDistance int64 `json:"direct_distance"`
+
+	// Passenger contracts only
+	PassengerClass  string `json:"passenger_class,omitempty"`
+	ComfortRequired int    `json:"comfort_required,omitempty"`
+	Satisfaction    int    `json:"satisfaction,omitempty"` // 0-120; scales the fare on arrival
+
+	// Player-posted contracts only: the poster's escrowed credits fund the payout
+	PostedBy string `json:"posted_by,omitempty"`
+	Escrow   int    `json:"escrow,omitempty"`  // Credits held; Payout may drop below it in transit
+	CorpID   string `json:"corp_id,omitempty"` // Funded from this corp's treasury (see corp.go)
+
+	// Mission legs only (see missions.go)
+	MissionID string `json:"mission_id,omitempty"`
+
+	// Special handling copied from the commodity (see handling.go)
+	Flags      []string `json:"flags,omitempty"`
+	Contraband bool     `json:"contraband,omitempty"` // Goods are banned at the destination
+
+	// Issuing faction (see reputation.go); premium jobs need standing with it
+	Faction     string `json:"faction,omitempty"`
+	MinStanding int    `json:"min_standing,omitempty"`
 }
 
 type Planet struct {
@@ -56,6 +199,21 @@ type Planet struct {
 	Production  []string `json:"production" yaml:"production"`
 	Demand      []string `json:"demand" yaml:"demand"`
 
+	// Stockpile overrides: CommodityKey -> units per heartbeat (see economy.go)
+	ProductionRates  map[string]int `json:"production_rates,omitempty" yaml:"production_rates"`
+	ConsumptionRates map[string]int `json:"consumption_rates,omitempty" yaml:"consumption_rates"`
+	StockpileCap     int            `json:"stockpile_cap,omitempty" yaml:"stockpile_cap"`
+
+	// Lane roughness 0.0-1.0 for jumps to/from this planet (damages fragile cargo)
+	LaneHazard float64 `json:"lane_hazard,omitempty" yaml:"lane_hazard"`
+
+	// Customs (see customs.go): inspection odds on arrival, and goods forbidden here
+	Security float64  `json:"security" yaml:"security"`
+	Banned   []string `json:"banned,omitempty" yaml:"banned"`
+
+	// Repair yard price multiplier (see maintenance.go); 0 = no yard
+	RepairPriceMult float64 `json:"repair_price_mult,omitempty" yaml:"repair_price_mult"`
+
 	// Economy Configuration: Per-planet limits
 	MinCargo      int `json:"min_cargo" yaml:"min_cargo"`
 	MaxCargo      int `json:"max_cargo" yaml:"max_cargo"`
@@ -63,64 +221,124 @@ type Planet struct {
 	MaxPassengers int `json:"max_passengers" yaml:"max_passengers"`
 }
 
+// Produces reports whether the planet lists the commodity in its production.
+func (p *Planet) Produces(itemKey string) bool {
+	for _, k := range p.Production {
+		if k == itemKey {
+			return true
+		}
+	}
+	return false
+}
+
+// Demands reports whether the planet lists the commodity in its demand.
+func (p *Planet) Demands(itemKey string) bool {
+	for _, k := range p.Demand {
+		if k == itemKey {
+			return true
+		}
+	}
+	return false
+}
+
 type Ship struct {
-	Name             string       `json:"name" yaml:"name"`
-	Fuel             int64        `json:"fuel"`
-	MaxFuel          int64        `json:"max_fuel" yaml:"max_fuel"`
-	LocationKey      string       `json:"location_key"`
-	BurnRate         int64        `json:"burn_rate" yaml:"fuel_burn_rate"`
-	CargoCapacity    int          `json:"cargo_capacity" yaml:"cargo_capacity"`
-	PassengerSlots   int          `json:"passenger_slots" yaml:"passenger_slots"`
-	Credits          int          `json:"credits"`
-	BaseMass         int64        `json:"base_mass" yaml:"base_mass"`
-	Efficiency       int64        `json:"engine_efficiency" yaml:"engine_efficiency"`
-	MaxModuleSlots   int          `json:"max_module_slots" yaml:"max_module_slots"`
-	InstalledModules []ShipModule `json:"installed_modules"`
-	ActiveContracts  []Contract   `json:"active_contracts"`
+	PilotID          string           `json:"pilot_id"`
+	ShipID           string           `json:"ship_id"` // Unique within the owner's fleet (see fleet.go)
+	Name             string           `json:"name" yaml:"name"`
+	Fuel             int64            `json:"fuel"`
+	MaxFuel          int64            `json:"max_fuel" yaml:"max_fuel"`
+	LocationKey      string           `json:"location_key"`
+	BurnRate         int64            `json:"burn_rate" yaml:"fuel_burn_rate"`
+	CargoCapacity    int              `json:"cargo_capacity" yaml:"cargo_capacity"`
+	PassengerSlots   int              `json:"passenger_slots" yaml:"passenger_slots"`
+	Comfort          int              `json:"comfort" yaml:"comfort"`             // Cabin quality; raised by comfort modules
+	Containment      int              `json:"containment" yaml:"containment"`     // Hazardous cargo vaults
+	Refrigeration    int              `json:"refrigeration" yaml:"refrigeration"` // Cold storage units
+	Concealment      int              `json:"concealment" yaml:"concealment"`     // Hidden compartments; cut customs odds
+	Credits          int              `json:"credits"`
+	BaseMass         int64            `json:"base_mass" yaml:"base_mass"`
+	Efficiency       int64            `json:"engine_efficiency" yaml:"engine_efficiency"`
+	MaxModuleSlots   int              `json:"max_module_slots" yaml:"max_module_slots"`
+	InstalledModules []ShipModule     `json:"installed_modules"`
+	ActiveContracts  []Contract       `json:"active_contracts"`
+	ActiveMissions   []Mission        `json:"active_missions"`
+	Insurance        *InsurancePolicy `json:"insurance,omitempty"`  // Covers the next jump
+	Voyages          int              `json:"voyages"`              // Jumps flown; seeds each voyage's RNG
+	HullCondition    float64          `json:"hull_condition"`       // 0-100; see maintenance.go
+	EngineCondition  float64          `json:"engine_condition"`     // 0-100; see maintenance.go
+	Crew             []CrewMember     `json:"crew"`                 // Hired crew; each takes a passenger berth
+	Automation       *Automation      `json:"automation,omitempty"` // Set while running a route (see fleet.go)
 }
 
 type PassengerConfig struct {
-	BaseTicketPrice  int `yaml:"base_ticket_price"`
-	MassPerPassenger int `yaml:"mass_per_passenger"`
+	BaseTicketPrice    int              `yaml:"base_ticket_price"`
+	MassPerPassenger   int              `yaml:"mass_per_passenger"`
+	DistancePayoutMult int              `yaml:"distance_payout_mult"` // Credits per LY per passenger
+	MoodDecayPerLY     int              `yaml:"mood_decay_per_ly"`    // Satisfaction lost per LY flown beyond the direct route
+	ComfortBonus       int              `yaml:"comfort_bonus"`        // Satisfaction gained per comfort point above the requirement
+	Classes            []PassengerClass `yaml:"classes"`
 }
 
 type Universe struct {
-	BalanceConfig    GameBalance     `yaml:"game_balance"`
-	PlayerShipConfig Ship            `yaml:"player_ship"`
-	Commodities      []Commodity     `yaml:"commodities"`
-	Planets          []Planet        `yaml:"planets"`
-	ShipModules      []ShipModule    `yaml:"ship_modules"`
-	PassengerConfig  PassengerConfig `yaml:"passenger_config"`
+	BalanceConfig     GameBalance       `yaml:"game_balance"`
+	PlayerShipConfig  Ship              `yaml:"player_ship"`
+	Commodities       []Commodity       `yaml:"commodities"`
+	Planets           []Planet          `yaml:"planets"`
+	ShipModules       []ShipModule      `yaml:"ship_modules"`
+	PassengerConfig   PassengerConfig   `yaml:"passenger_config"`
+	MarketModel       MarketModel       `yaml:"market_model"`
+	EventConfig       EventConfig       `yaml:"event_config"`
+	NPCConfig         NPCConfig         `yaml:"npc_traders"`
+	AuctionConfig     AuctionConfig     `yaml:"auctions"`
+	MissionConfig     MissionConfig     `yaml:"mission_config"`
+	Missions          []MissionTemplate `yaml:"missions"`
+	HandlingConfig    HandlingConfig    `yaml:"cargo_handling"`
+	CustomsConfig     CustomsConfig     `yaml:"customs"`
+	Factions          []Faction         `yaml:"factions"`
+	ReputationConfig  ReputationConfig  `yaml:"reputation"`
+	BankConfig        BankConfig        `yaml:"bank"`
+	RiskConfig        RiskConfig        `yaml:"transit_risk"`
+	MaintenanceConfig MaintenanceConfig `yaml:"maintenance"`
+	CrewConfig        CrewConfig        `yaml:"crew"`
+	FleetConfig       FleetConfig       `yaml:"fleet"`
+	CorpConfig        CorpConfig        `yaml:"corporations"`
+	LedgerConfig      LedgerConfig      `yaml:"ledger"`
+	GalacticEvents    []GalacticEvent   `yaml:"galactic_events"`
 }
 
 type Commodity struct {
-	Key       string `yaml:"key" json:"key"`
-	Name      string `yaml:"name" json:"name"`
-	BaseValue int    `yaml:"base_value" json:"base_value"`
-	Mass      int    `yaml:"mass" json:"mass"`
+	Key       string   `yaml:"key" json:"key"`
+	Name      string   `yaml:"name" json:"name"`
+	BaseValue int      `yaml:"base_value" json:"base_value"`
+	Mass      int      `yaml:"mass" json:"mass"`
+	Flags     []string `yaml:"flags" json:"flags,omitempty"` // Special handling (see handling.go)
 }
 
 // MarketState tracks the "Heat" (Supply/Demand pressure) of the economy.
 type MarketState struct {
 	// SourceHeat maps PlanetKey -> CommodityKey -> HeatLevel (float64)
-	// High SourceHeat = Resource is mined out (Lower Spawn Rate)
+	// High SourceHeat = Export pressure (recorded for telemetry; spawns follow Stockpile)
 	SourceHeat map[string]map[string]float64
 
 	// DestHeat maps PlanetKey -> CommodityKey -> HeatLevel (float64)
 	// High DestHeat = Market is flooded (Lower Payouts)
 	DestHeat map[string]map[string]float64
+
+	// Stockpile maps PlanetKey -> CommodityKey -> Units in the warehouse
+	Stockpile map[string]map[string]int
 }
 
 var (
 	dataLock           sync.RWMutex
 	CurrentUniverse    Universe
-	PlayerShip         Ship
+	Pilots             = make(map[string]*Ship) // PilotID -> Ship
 	AvailableContracts = make(map[string][]Contract)
 
 	// Global Market Instance
 	Market = MarketState{
 		SourceHeat: make(map[string]map[string]float64),
 		DestHeat:   make(map[string]map[string]float64),
+		Stockpile:  make(map[string]map[string]int),
 	}
 )
 
@@ -138,29 +356,26 @@ func InitMarket() {
 }
 
 // RecordAcceptance increases Source Heat (Making it scarcer).
+// Caller must hold dataLock for writing.
 func (m *MarketState) RecordAcceptance(originKey, itemKey string, qty int) {
-	dataLock.Lock()
-	defer dataLock.Unlock()
-
 	if m.SourceHeat[originKey] == nil {
 		return
 	}
-	// Impact factor: 0.01 heat per unit.
-	impact := float64(qty) * 0.01
-	m.SourceHeat[originKey][itemKey] += impact
+	model := CurrentUniverse.MarketModel
+	impact := float64(qty) * model.acceptanceImpact(itemKey)
+	m.SourceHeat[originKey][itemKey] = model.clamp(m.SourceHeat[originKey][itemKey] + impact)
 }
 
 // RecordDelivery increases Destination Heat (Crashing the price).
+// Caller must hold dataLock for writing.
 func (m *MarketState) RecordDelivery(destKey, itemKey string, qty int) {
-	dataLock.Lock()
-	defer dataLock.Unlock()
-
 	if m.DestHeat[destKey] == nil {
 		return
 	}
-	// Impact factor: 0.02 per unit (Markets crash faster than mines deplete).
-	impact := float64(qty) * 0.02
-	m.DestHeat[destKey][itemKey] += impact
+	// Markets crash faster than mines deplete (delivery_impact > acceptance_impact by default)
+	model := CurrentUniverse.MarketModel
+	impact := float64(qty) * model.deliveryImpact(itemKey)
+	m.DestHeat[destKey][itemKey] = model.clamp(m.DestHeat[destKey][itemKey] + impact)
 }
 
 // MarketTick "Cools down" the economy (Regeneration/Consumption).
@@ -168,27 +383,19 @@ func MarketTick() {
 	dataLock.Lock()
 	defer dataLock.Unlock()
 
-	recoveryRate := 0.05 // 5% recovery per tick towards 1.0
+	model := CurrentUniverse.MarketModel
 
 	// Cool Source Heat
 	for pKey, commodities := range Market.SourceHeat {
 		for cKey, heat := range commodities {
-			if heat > 1.0 {
-				Market.SourceHeat[pKey][cKey] = math.Max(1.0, heat-recoveryRate)
-			} else if heat < 1.0 {
-				Market.SourceHeat[pKey][cKey] = math.Min(1.0, heat+recoveryRate)
-			}
+			Market.SourceHeat[pKey][cKey] = model.recover(cKey, heat)
 		}
 	}
 
 	// Cool Dest Heat
 	for pKey, commodities := range Market.DestHeat {
 		for cKey, heat := range commodities {
-			if heat > 1.0 {
-				Market.DestHeat[pKey][cKey] = math.Max(1.0, heat-recoveryRate)
-			} else if heat < 1.0 {
-				Market.DestHeat[pKey][cKey] = math.Min(1.0, heat+recoveryRate)
-			}
+			Market.DestHeat[pKey][cKey] = model.recover(cKey, heat)
 		}
 	}
 }
@@ -228,22 +435,23 @@ func CalculateDistance(p1, p2 []int) int64 {
 	return int64(math.Round(dist))
 }
 
-func CalculateTotalMass() int64 {
-	total := PlayerShip.BaseMass
-	for _, c := range PlayerShip.ActiveContracts {
+func CalculateTotalMass(ship *Ship) int64 {
+	total := ship.BaseMass
+	for _, c := range ship.ActiveContracts {
 		if c.Type == "cargo" {
 			total += int64(c.MassPerUnit * c.Quantity)
 		} else {
 			total += int64(CurrentUniverse.PassengerConfig.MassPerPassenger * c.Quantity)
 		}
 	}
-	fuelMass := (PlayerShip.Fuel / 100) * int64(CurrentUniverse.BalanceConfig.FuelMassPerUnit)
+	fuelMass := (ship.Fuel / 100) * int64(CurrentUniverse.BalanceConfig.FuelMassPerUnit)
 	return total + fuelMass
 }
 
-func CalculateCurrentBurn() int64 {
-	mass := CalculateTotalMass()
-	return int64(CurrentUniverse.BalanceConfig.BaseBurnRate) + (mass / PlayerShip.Efficiency)
+func CalculateCurrentBurn(ship *Ship) int64 {
+	mass := CalculateTotalMass(ship)
+	burn := int64(CurrentUniverse.BalanceConfig.BaseBurnRate) + (mass / effectiveEfficiency(ship))
+	return int64(float64(burn) * hullDragMult(ship) * crewReduction(ship, RolePilot))
 }
 
 // ReplenishMarket is the "Heartbeat" logic.
@@ -257,6 +465,9 @@ func ReplenishMarket() []string {
 	dataLock.Lock()
 	defer dataLock.Unlock()
 
+	// 2. Planets produce and consume before new exports are posted
+	EconomyTick()
+
 	rand.Seed(time.Now().UnixNano())
 	updatedPlanets := []string{}
 
@@ -327,94 +538,118 @@ func ReplenishMarket() []string {
 		}
 	}
 
+	// Snapshot the economy for /api/telemetry
+	recordTelemetry()
+
 	return updatedPlanets
 }
 
 // generateCargoJobs creates 'count' new cargo contracts for the given origin.
 func generateCargoJobs(origin *Planet, count int) {
 	for i := 0; i < count; i++ {
-		// 1. Pick Commodity
-		// Preference: 80% Local Production, 20% Global Random
-		var comm Commodity
-
-		if len(origin.Production) > 0 && rand.Float32() < 0.8 {
-			prodKey := origin.Production[rand.Intn(len(origin.Production))]
-			commPtr := GetCommodity(prodKey)
-			if commPtr != nil {
-				comm = *commPtr
-			} else {
-				comm = CurrentUniverse.Commodities[rand.Intn(len(CurrentUniverse.Commodities))]
-			}
-		} else {
-			comm = CurrentUniverse.Commodities[rand.Intn(len(CurrentUniverse.Commodities))]
+		job := newCargoContract(origin)
+		if job == nil {
+			continue // Nothing to export, or nobody will take it
 		}
 
-		// MARKET SCARCITY CHECK
-		sourceHeat := Market.SourceHeat[origin.Key][comm.Key]
-		// If heat is high, skip generating this specific contract chance
-		if sourceHeat > 1.0 && rand.Float64()*sourceHeat > 1.5 {
-			continue
-		}
+		// Append to the specific planet's board
+		AvailableContracts[origin.Key] = append(AvailableContracts[origin.Key], *job)
+	}
+}
 
-		// 2. Pick Destination
-		dest := CurrentUniverse.Planets[rand.Intn(len(CurrentUniverse.Planets))]
-		for dest.Key == origin.Key {
-			dest = CurrentUniverse.Planets[rand.Intn(len(CurrentUniverse.Planets))]
-		}
+// newCargoContract prices one export from the origin's warehouse. The shipment
+// leaves the stockpile now. Returns nil if there is nothing to ship.
+func newCargoContract(origin *Planet) *Contract {
+	// 1. Pick Commodity from what's actually in the warehouse
+	comm := pickExport(origin.Key)
+	if comm == nil {
+		return nil
+	}
 
-		// 3. Stats & Pricing
-		qty := rand.Intn(21) + 5
-		dist := CalculateDistance(origin.Coordinates, dest.Coordinates)
-
-		// MARKET DEMAND CHECK
-		destHeat := Market.DestHeat[dest.Key][comm.Key]
-		priceMod := 1.0 / destHeat
-
-		basePayout := int(dist)*CurrentUniverse.BalanceConfig.DistancePayoutMult + (comm.BaseValue * qty / 2)
-		finalPayout := int(float64(basePayout) * priceMod)
-
-		// 4. Create Contract
-		job := Contract{
-			ID:             fmt.Sprintf("CRG-%d-%d", rand.Intn(99999), time.Now().UnixNano()%1000),
-			Type:           "cargo",
-			ItemName:       comm.Name,
-			ItemKey:        comm.Key,
-			Quantity:       qty,
-			MassPerUnit:    comm.Mass,
-			OriginKey:      origin.Key,
-			DestinationKey: dest.Key,
-			Payout:         finalPayout,
-		}
+	// 2. Pick Destination (weighted towards planets that demand the good)
+	dest, demandMod := pickCargoDestination(origin, comm.Key)
+	if dest == nil {
+		return nil
+	}
 
-		// Append to the specific planet's board
-		AvailableContracts[origin.Key] = append(AvailableContracts[origin.Key], job)
+	// 3. Stats & Pricing
+	qty := rand.Intn(21) + 5
+	if stock := Market.Stockpile[origin.Key][comm.Key]; qty > stock {
+		qty = stock
+	}
+	Market.Stockpile[origin.Key][comm.Key] -= qty
+	dist := CalculateDistance(origin.Coordinates, dest.Coordinates)
+
+	// MARKET DEMAND CHECK
+	destHeat := Market.DestHeat[dest.Key][comm.Key]
+	priceMod := 1.0 / destHeat
+
+	basePayout := int(dist)*CurrentUniverse.BalanceConfig.DistancePayoutMult + (comm.BaseValue * qty / 2)
+	eventMult := EventPayoutMult(origin.Key, dest.Key)
+	finalPayout := int(float64(basePayout) * priceMod * demandMod * handlingPremium(comm) * eventMult)
+	if isBanned(dest, comm.Key) && CurrentUniverse.CustomsConfig.ContrabandPremium > 0 {
+		finalPayout = int(float64(finalPayout) * CurrentUniverse.CustomsConfig.ContrabandPremium)
 	}
+
+	// 4. Create Contract
+	job := &Contract{
+		ID:             fmt.Sprintf("CRG-%d-%d", rand.Intn(99999), time.Now().UnixNano()%1000),
+		Type:           "cargo",
+		Quantity:       qty,
+		OriginKey:      origin.Key,
+		DestinationKey: dest.Key,
+		Payout:         finalPayout,
+		DirectDistance: dist,
+		eventMult:      eventMult,
+	}
+	job.setCommodity(comm)
+	tagFaction(job, rand.Float64())
+	return job
 }
 
-// generatePassengerJobs creates 'count' new passenger contracts.
-func generatePassengerJobs(origin *Planet, count int) {
-	for i := 0; i < count; i++ {
-		dest := CurrentUniverse.Planets[rand.Intn(len(CurrentUniverse.Planets))]
-		for dest.Key == origin.Key {
-			dest = CurrentUniverse.Planets[rand.Intn(len(CurrentUniverse.Planets))]
+// pickCargoDestination chooses where a commodity should be shipped. Planets that
+// demand it are DemandWeight times likelier than neutral ones and pay a premium;
+// planets that produce it are skipped unless allow_producer_destinations is set.
+// Returns the payout multiplier, or nil if no planet qualifies.
+func pickCargoDestination(origin *Planet, itemKey string) (*Planet, float64) {
+	model := CurrentUniverse.MarketModel
+
+	type candidate struct {
+		planet *Planet
+		weight float64
+		mult   float64
+	}
+	candidates := []candidate{}
+	total := 0.0
+
+	for i := range CurrentUniverse.Planets {
+		p := &CurrentUniverse.Planets[i]
+		if p.Key == origin.Key {
+			continue
+		}
+		c := candidate{planet: p, weight: 1.0, mult: 1.0}
+		switch {
+		case p.Produces(itemKey):
+			if !model.AllowProducerDests {
+				continue
+			}
+			c.mult = model.ProducerPayoutMult
+		case p.Demands(itemKey):
+			c.weight = model.DemandWeight
+			c.mult = model.DemandPremium
 		}
+		candidates = append(candidates, c)
+		total += c.weight
+	}
 
-		dist := CalculateDistance(origin.Coordinates, dest.Coordinates)
-		payout := int(dist)*15 + CurrentUniverse.PassengerConfig.BaseTicketPrice
-
-		job := Contract{
-			ID:             fmt.Sprintf("PAX-%d-%d", rand.Intn(99999), time.Now().UnixNano()%1000),
-			Type:           "passenger",
-			ItemName:       "Passenger",
-			ItemKey:        "passenger",
-			Quantity:       1,
-			MassPerUnit:    CurrentUniverse.PassengerConfig.MassPerPassenger,
-			OriginKey:      origin.Key,
-			DestinationKey: dest.Key,
-			Payout:         payout,
+	roll := rand.Float64() * total
+	for _, c := range candidates {
+		if roll < c.weight {
+			return c.planet, c.mult
 		}
-		AvailableContracts[origin.Key] = append(AvailableContracts[origin.Key], job)
+		roll -= c.weight
 	}
+	return nil, 0
 }
 
 func LoadConfig() error {
@@ -429,17 +664,46 @@ func LoadConfig() error {
 	if err := yaml.Unmarshal(f, &newUni); err != nil {
 		return err
 	}
+	newUni.MarketModel = newUni.MarketModel.withDefaults()
 	CurrentUniverse = newUni
 
 	InitMarket()
+	InitStockpiles()
+	InitNPCs()
+	InitRisk()
+	return nil
+}
 
-	if PlayerShip.LocationKey == "" {
-		PlayerShip = CurrentUniverse.PlayerShipConfig
-		PlayerShip.Fuel = PlayerShip.MaxFuel
-		PlayerShip.LocationKey = "planet_prime"
-		PlayerShip.Credits = CurrentUniverse.BalanceConfig.StartingCredits
-		PlayerShip.ActiveContracts = []Contract{}
-		PlayerShip.InstalledModules = []ShipModule{}
+// GetPilotShip returns the pilot's ship, commissioning a fresh one from the
+// player_ship template on first use. Caller must hold dataLock for writing.
+func GetPilotShip(pilotID string) *Ship {
+	if ship, ok := Pilots[pilotID]; ok {
+		return ship
 	}
-	return nil
+	ship := newShip(pilotID)
+	Pilots[pilotID] = ship
+	addToFleet(ship)
+	recordCredits(ship, ship.Credits, LedgerEntry{Reason: "starting_credits"})
+	return ship
+}
+
+// newShip builds a ship from the player_ship template, docked at Prime.
+func newShip(pilotID string) *Ship {
+	return commission(CurrentUniverse.PlayerShipConfig, pilotID)
+}
+
+// commission builds a new, fully fuelled ship from a template.
+func commission(template Ship, pilotID string) *Ship {
+	ship := template
+	ship.PilotID = pilotID
+	ship.Fuel = ship.MaxFuel
+	ship.HullCondition = 100
+	ship.EngineCondition = 100
+	ship.LocationKey = "planet_prime"
+	ship.Credits = CurrentUniverse.BalanceConfig.StartingCredits
+	ship.ActiveContracts = []Contract{}
+	ship.ActiveMissions = []Mission{}
+	ship.InstalledModules = []ShipModule{}
+	ship.Crew = []CrewMember{}
+	return &ship
 }
@@ -0,0 +1,196 @@
+/*
+Package main
+File: telemetry.go
+Description: Records a snapshot of the economy at every ReplenishMarket (heat maps,
+average open contract payouts, board volume) so the balance team and the client
+can chart prices over time via /api/telemetry.
+*/
+
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const telemetryCapacity = 1440 // 24h of samples at the 60s heartbeat
+
+// PlanetVolume counts open contracts on a planet's board.
+type PlanetVolume struct {
+	Cargo     int `json:"cargo"`
+	Passenger int `json:"passenger"`
+}
+
+// TelemetrySample is the state of the economy at one heartbeat.
+type TelemetrySample struct {
+	Timestamp   int64                         `json:"timestamp"` // Unix seconds
+	SourceHeat  map[string]map[string]float64 `json:"source_heat"`
+	DestHeat    map[string]map[string]float64 `json:"dest_heat"`
+	AvgPayout   map[string]float64            `json:"avg_payout"`   // CommodityKey -> mean payout of open cargo contracts
+	RoutePayout map[string]map[string]float64 `json:"route_payout"` // "origin->destination" -> CommodityKey ("passenger" for fares) -> mean payout of open contracts
+	Volume      map[string]PlanetVolume       `json:"volume"`       // PlanetKey -> open contracts
+	Stockpile   map[string]map[string]int     `json:"stockpile"`    // PlanetKey -> CommodityKey -> units
+}
+
+var (
+	telemetryLock sync.RWMutex
+	telemetry     []TelemetrySample
+)
+
+// recordTelemetry snapshots the market. Caller must hold dataLock.
+func recordTelemetry() {
+	sample := TelemetrySample{
+		Timestamp:   time.Now().Unix(),
+		SourceHeat:  copyHeat(Market.SourceHeat),
+		DestHeat:    copyHeat(Market.DestHeat),
+		AvgPayout:   make(map[string]float64),
+		RoutePayout: make(map[string]map[string]float64),
+		Volume:      make(map[string]PlanetVolume),
+		Stockpile:   make(map[string]map[string]int),
+	}
+	for p, goods := range Market.Stockpile {
+		sample.Stockpile[p] = make(map[string]int, len(goods))
+		for c, units := range goods {
+			sample.Stockpile[p][c] = units
+		}
+	}
+
+	commodityCount := make(map[string]int)
+	routeCount := make(map[string]map[string]int)
+	for planetKey, board := range AvailableContracts {
+		vol := PlanetVolume{}
+		for _, c := range board {
+			if c.Type == "cargo" {
+				vol.Cargo++
+				sample.AvgPayout[c.ItemKey] += float64(c.Payout)
+				commodityCount[c.ItemKey]++
+			} else {
+				vol.Passenger++
+			}
+			route := c.OriginKey + "->" + c.DestinationKey
+			if sample.RoutePayout[route] == nil {
+				sample.RoutePayout[route] = make(map[string]float64)
+				routeCount[route] = make(map[string]int)
+			}
+			sample.RoutePayout[route][c.ItemKey] += float64(c.Payout)
+			routeCount[route][c.ItemKey]++
+		}
+		sample.Volume[planetKey] = vol
+	}
+	for k, n := range commodityCount {
+		sample.AvgPayout[k] /= float64(n)
+	}
+	for route, counts := range routeCount {
+		for k, n := range counts {
+			sample.RoutePayout[route][k] /= float64(n)
+		}
+	}
+
+	telemetryLock.Lock()
+	defer telemetryLock.Unlock()
+	telemetry = append(telemetry, sample)
+	if len(telemetry) > telemetryCapacity {
+		telemetry = telemetry[len(telemetry)-telemetryCapacity:]
+	}
+}
+
+func copyHeat(src map[string]map[string]float64) map[string]map[string]float64 {
+	out := make(map[string]map[string]float64, len(src))
+	for p, commodities := range src {
+		out[p] = make(map[string]float64, len(commodities))
+		for c, heat := range commodities {
+			out[p][c] = heat
+		}
+	}
+	return out
+}
+
+// QueryTelemetry returns samples in [from, to] (Unix seconds, 0 = unbounded),
+// optionally narrowed to one planet and/or commodity.
+func QueryTelemetry(from, to int64, planetKey, commodityKey string) []TelemetrySample {
+	telemetryLock.RLock()
+	defer telemetryLock.RUnlock()
+
+	out := []TelemetrySample{}
+	for _, s := range telemetry {
+		if (from > 0 && s.Timestamp < from) || (to > 0 && s.Timestamp > to) {
+			continue
+		}
+		out = append(out, filterSample(s, planetKey, commodityKey))
+	}
+	return out
+}
+
+// filterSample copies only the parts of a sample matching the filters.
+func filterSample(s TelemetrySample, planetKey, commodityKey string) TelemetrySample {
+	if planetKey == "" && commodityKey == "" {
+		return s
+	}
+
+	filterHeat := func(src map[string]map[string]float64) map[string]map[string]float64 {
+		out := make(map[string]map[string]float64)
+		for p, commodities := range src {
+			if planetKey != "" && p != planetKey {
+				continue
+			}
+			out[p] = make(map[string]float64)
+			for c, heat := range commodities {
+				if commodityKey == "" || c == commodityKey {
+					out[p][c] = heat
+				}
+			}
+		}
+		return out
+	}
+
+	f := TelemetrySample{
+		Timestamp:   s.Timestamp,
+		SourceHeat:  filterHeat(s.SourceHeat),
+		DestHeat:    filterHeat(s.DestHeat),
+		AvgPayout:   make(map[string]float64),
+		RoutePayout: make(map[string]map[string]float64),
+		Volume:      make(map[string]PlanetVolume),
+		Stockpile:   make(map[string]map[string]int),
+	}
+	for p, goods := range s.Stockpile {
+		if planetKey != "" && p != planetKey {
+			continue
+		}
+		f.Stockpile[p] = make(map[string]int)
+		for c, units := range goods {
+			if commodityKey == "" || c == commodityKey {
+				f.Stockpile[p][c] = units
+			}
+		}
+	}
+	for c, avg := range s.AvgPayout {
+		if commodityKey == "" || c == commodityKey {
+			f.AvgPayout[c] = avg
+		}
+	}
+	for route, payouts := range s.RoutePayout {
+		if planetKey != "" && !routeTouches(route, planetKey) {
+			continue
+		}
+		for c, avg := range payouts {
+			if commodityKey == "" || c == commodityKey {
+				if f.RoutePayout[route] == nil {
+					f.RoutePayout[route] = make(map[string]float64)
+				}
+				f.RoutePayout[route][c] = avg
+			}
+		}
+	}
+	for p, vol := range s.Volume {
+		if planetKey == "" || p == planetKey {
+			f.Volume[p] = vol
+		}
+	}
+	return f
+}
+
+// routeTouches reports whether an "origin->destination" key involves the planet.
+func routeTouches(route, planetKey string) bool {
+	return strings.HasPrefix(route, planetKey+"->") || strings.HasSuffix(route, "->"+planetKey)
+}